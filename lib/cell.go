@@ -2,21 +2,58 @@ package lib
 
 import (
 	"github.com/golang/freetype/truetype"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/image/font"
 	"image/color"
-	"unicode"
+	"math"
+	"strings"
 )
 
 const defaultSize = 12
 
+// cellPadding 文本与单元格左右边界的间距
+const cellPadding = 4
+
+// indentWidth 每级缩进的宽度 为一个字符(默认字体最大数字)的宽度
+const indentWidth = maxDigitWidth * renderDPI / 96
+
+// stackedRotation 文字竖排 每个字符一行
+const stackedRotation = 255
+
+// scriptScale 上标和下标的字号比例
+const scriptScale = 2.0 / 3
+
+// superscriptRise subscriptDrop 上标基线上移和下标基线下移的距离 与原字号的比例
+const (
+	superscriptRise = 1.0 / 3
+	subscriptDrop   = 1.0 / 7
+)
+
 type ICell struct {
-	Axis    string
-	Hide    bool
-	MrMain  bool
-	MrTypeX bool
-	Value   string
-	Style   *Style
-	Width   int
-	Height  int
+	Axis string
+	// Row Col 在绘制网格中的下标
+	Row    int
+	Col    int
+	Hide   bool
+	MrMain bool
+	Merge  *IMerge
+	Value  string
+	// Runs 富文本中每一段的文本和字体 不是富文本时为nil
+	Runs   []*IRun
+	Type   excelize.CellType
+	Style  *Style
+	Width  int
+	Height int
+	faces  map[Font]font.Face
+	fonts  *FontRegistry
+	// shrink 缩小字体填充时字号的缩放比例 为0时不缩放
+	shrink float64
+	shaper *cellShaper
+	// fill 数字格式中 * 指定的填充字符 绘制时在 Value 的 fillAt 处重复到占满单元格宽度, 为0时不填充
+	fill   rune
+	fillAt int
+	// general 常规格式的数字 宽度不够时先减少显示的位数, 不是常规格式时为nil
+	general *float64
 }
 
 func (c *ICell) getBgColor() color.Color {
@@ -27,29 +64,70 @@ func (c *ICell) getBgColor() color.Color {
 	return colorFromStr(cr)
 }
 
-func (c *ICell) getFontTT() *truetype.Font {
-	family := c.Style.Font.Name
-	if c.Style.Font.Bold {
-		family = family + "_bold"
-		if ft, ok := fontTTs[family]; ok {
-			return ft
+// getFontTT 按字体名称, 粗体和斜体查找字体 boldSyn italicSyn 标记需要模拟的粗体和斜体
+func (c *ICell) getFontTT(f Font) (ft *truetype.Font, boldSyn, italicSyn bool) {
+	return c.fonts.Lookup(f.Name, f.Bold, f.Italic)
+}
+
+// getFace 单元格字体的 font.Face
+func (c *ICell) getFace() font.Face {
+	return c.getRunFace(c.Style.Font)
+}
+
+// getRunFace 按字体和字号创建的 font.Face 用于测量和绘制文本 字体缺少的字符使用后备字体
+func (c *ICell) getRunFace(f Font) font.Face {
+	if c.faces == nil {
+		c.faces = map[Font]font.Face{}
+	}
+	face, ok := c.faces[f]
+	if !ok {
+		ft, boldSyn, italicSyn := c.getFontTT(f)
+		face = newFallbackFace(c.newFace(f, ft, boldSyn, italicSyn), ft, f, c.fonts, func(fb fallbackFont) font.Face {
+			return c.newFace(f, fb.ft, fb.boldSyn, fb.italicSyn)
+		})
+		c.faces[f] = face
+	}
+	return face
+}
+
+// newFace 按字号创建字体 ft 的 font.Face, 模拟需要的粗体和斜体
+func (c *ICell) newFace(f Font, ft *truetype.Font, boldSyn, italicSyn bool) font.Face {
+	if c.fonts.isBitmapFont(ft) {
+		if face := c.shapingFace(ft); face != nil {
+			return newBitmapFace(face, c.getRunSize(f)*renderDPI/72)
 		}
-		return fontTTs["微软雅黑_bold"]
 	}
-	if ft, ok := fontTTs[family]; ok {
-		return ft
+	face := truetype.NewFace(ft, &truetype.Options{
+		Size:    c.getRunSize(f),
+		DPI:     renderDPI,
+		Hinting: font.HintingFull,
+	})
+	if boldSyn || italicSyn {
+		face = newSyntheticFace(face, c.getRunSize(f)*renderDPI/72, boldSyn, italicSyn)
 	}
-	return fontTTs["微软雅黑"]
+	return face
 }
 
 func (c *ICell) getFontColor() color.Color {
-	cr := c.Style.Font.Color
+	return c.getRunColor(c.Style.Font)
+}
+
+func (c *ICell) getRunColor(f Font) color.Color {
+	cr := f.Color
 	if cr == "" {
 		return color.Black
 	}
 	return colorFromStr(cr)
 }
 
+// getRuns 单元格的文本段 不是富文本时为单元格字体的一段文本
+func (c *ICell) getRuns() []*IRun {
+	if c.Runs != nil {
+		return c.Runs
+	}
+	return []*IRun{{Text: c.Value, Font: c.Style.Font}}
+}
+
 func (c *ICell) getBorderLeftColor() color.Color {
 	cr := c.Style.Border.Left
 	if cr == "" {
@@ -82,46 +160,419 @@ func (c *ICell) getBorderBottomColor() color.Color {
 }
 
 func (c *ICell) getSize() int {
-	size := c.Style.Font.Size
+	return fontSize(c.Style.Font)
+}
+
+func fontSize(f Font) int {
+	size := f.Size
 	if size == 0 {
 		return defaultSize
 	}
 	return int(size)
 }
 
-func (c *ICell) getBeginPY() (y int) {
-	y = 0
+// getFontSize 绘制的字号 缩小字体填充时为缩小后的字号
+func (c *ICell) getFontSize() float64 {
+	return c.getRunSize(c.Style.Font)
+}
+
+// getRunSize 文本段绘制的字号 上标和下标按 scriptScale 缩小
+func (c *ICell) getRunSize(f Font) float64 {
+	size := c.getEmSize(f)
+	if f.VertAlign == "superscript" || f.VertAlign == "subscript" {
+		size *= scriptScale
+	}
+	return size
+}
+
+// getEmSize 文本段的字号 不含上下标的缩小
+func (c *ICell) getEmSize(f Font) float64 {
+	if c.shrink > 0 {
+		return float64(fontSize(f)) * c.shrink
+	}
+	return float64(fontSize(f))
+}
+
+// getBaselineShift 上标基线上移和下标基线下移的像素 上移为正
+func (c *ICell) getBaselineShift(f Font) int {
+	px := c.getEmSize(f) * renderDPI / 72
+	switch f.VertAlign {
+	case "superscript":
+		return int(math.Round(px * superscriptRise))
+	case "subscript":
+		return -int(math.Round(px * subscriptDrop))
+	}
+	return 0
+}
+
+// shrinkToFit 缩小字体填充 缩小字号直到文本放入单元格宽度, 自动换行或文字旋转时不缩小
+func (c *ICell) shrinkToFit() {
+	agt := c.Style.Alignment
+	if !agt.ShrinkToFit || agt.WrapText || agt.TextRotation != 0 || c.Width <= 0 {
+		return
+	}
+	avail := c.Width - 2*cellPadding - c.getIndent()
+	if avail <= 0 {
+		return
+	}
+	for w := c.getValWidth(); w > avail && c.getFontSize() > 1; w = c.getValWidth() {
+		scale := math.Min(float64(avail)/float64(w), 0.95)
+		if c.shrink == 0 {
+			c.shrink = 1
+		}
+		c.shrink *= scale
+		c.faces = nil
+		c.shaper = nil
+	}
+}
+
+// isNumber 单元格的值是否为数字或日期
+func (c *ICell) isNumber() bool {
+	switch c.Type {
+	case excelize.CellTypeUnset, excelize.CellTypeNumber, excelize.CellTypeDate:
+		return c.Value != ""
+	}
+	return false
+}
+
+// canOverflow 放不下的文本是否可以溢出到相邻的单元格
+// 合并单元格, 数字, 折行, 缩小字体填充, 填充对齐和旋转的文字不溢出
+func (c *ICell) canOverflow() bool {
+	if c.Merge != nil || c.isNumber() || c.isWrap() || c.Style.Alignment.ShrinkToFit || c.Style.Alignment.TextRotation != 0 {
+		return false
+	}
+	switch c.getHorizontal() {
+	case "left", "right", "center":
+		return true
+	}
+	return false
+}
+
+// fitNumber 单元格宽度放不下的数字显示为 ####
+// 常规格式的数字先减少小数位数或改用科学计数, 仍放不下时才显示为 ####
+func (c *ICell) fitNumber() {
+	if !c.isNumber() || c.Style.Alignment.TextRotation != 0 || c.Width <= 0 {
+		return
+	}
+	avail := c.getTextWidth()
+	if c.getValWidth() <= avail {
+		return
+	}
+	if c.general != nil {
+		value := c.Value
+		for width := generalWidth - 1; width > 0; width-- {
+			s := formatGeneralWidth(math.Abs(*c.general), width)
+			if s == "" {
+				break
+			}
+			if *c.general < 0 {
+				s = "-" + s
+			}
+			if c.Value = s; c.getValWidth() <= avail {
+				return
+			}
+		}
+		c.Value = value
+	}
+	n := maxInt(1, avail/measureText(c.getFace(), "#"))
+	c.Value = strings.Repeat("#", n)
+	c.fill = 0
+}
+
+// fillNumber 重复数字格式中的填充字符 使数字占满单元格宽度, 折行和旋转的文字不填充
+func (c *ICell) fillNumber() {
+	if c.fill == 0 || c.Runs != nil || c.isWrap() || c.Style.Alignment.TextRotation != 0 || c.Width <= 0 {
+		return
+	}
+	w := measureText(c.getFace(), string(c.fill))
+	if w <= 0 {
+		return
+	}
+	n := (c.getTextWidth() - c.getValWidth()) / w
+	if n > 0 {
+		c.Value = c.Value[:c.fillAt] + strings.Repeat(string(c.fill), n) + c.Value[c.fillAt:]
+	}
+	c.fill = 0
+}
+
+// getIndent 缩进的宽度 只用于左对齐, 右对齐和分散对齐
+func (c *ICell) getIndent() int {
+	switch c.getHorizontal() {
+	case "left", "right", "distributed":
+		return c.Style.Alignment.Indent * indentWidth
+	}
+	return 0
+}
+
+// getHorizontal 水平对齐方式 常规对齐时数字和日期靠右, 逻辑值和错误值居中, 文本靠左(从右到左的文本靠右)
+func (c *ICell) getHorizontal() string {
+	if h := c.Style.Alignment.Horizontal; h != "" && h != "general" {
+		return h
+	}
+	switch c.Type {
+	case excelize.CellTypeUnset, excelize.CellTypeNumber, excelize.CellTypeDate:
+		return "right"
+	case excelize.CellTypeBool, excelize.CellTypeError:
+		return "center"
+	}
+	if c.isRTL() {
+		return "right"
+	}
+	return "left"
+}
+
+// isWrap 是否折行 两端对齐和分散对齐同样会折行
+func (c *ICell) isWrap() bool {
+	agt := c.Style.Alignment
+	switch {
+	case agt.WrapText:
+		return true
+	case agt.Horizontal == "justify", agt.Horizontal == "distributed":
+		return true
+	case agt.Vertical == "justify", agt.Vertical == "distributed":
+		return true
+	}
+	return false
+}
+
+// lineMetrics 一行文本的度量 取行内最大的字体
+type lineMetrics struct {
+	ascent  int
+	descent int
+	// height 行距 与 Excel 单行的自动行高相同
+	height int
+	size   int
+}
+
+func (c *ICell) getLineMetrics(line textLine) lineMetrics {
+	runs := []*IRun(line)
+	if len(runs) == 0 {
+		runs = []*IRun{{Font: c.Style.Font}}
+	}
+	lm := lineMetrics{}
+	for _, r := range runs {
+		m := c.getRunFace(r.Font).Metrics()
+		shift := c.getBaselineShift(r.Font)
+		lm.ascent = maxInt(lm.ascent, m.Ascent.Ceil()+shift)
+		lm.descent = maxInt(lm.descent, m.Descent.Ceil()-shift)
+		lm.height = maxInt(lm.height, pointsToPixels(c.getEmSize(r.Font)*autoRowHeightRate))
+		lm.size = maxInt(lm.size, fontSize(r.Font))
+	}
+	return lm
+}
+
+// getLineOffsets 每行基线相对文本块上边界的偏移 及文本块的高度
+func (c *ICell) getLineOffsets(lines []textLine) (ys []int, h int) {
+	ys = make([]int, len(lines))
+	descent := 0
+	for i, line := range lines {
+		m := c.getLineMetrics(line)
+		if i == 0 {
+			ys[i] = m.ascent
+		} else {
+			ys[i] = ys[i-1] + descent + m.height - m.descent
+		}
+		descent = m.descent
+		h = ys[i] + descent
+	}
+	return
+}
+
+// getBaselines 每行文本基线的纵坐标
+// 垂直两端对齐和分散对齐时多行文本均匀分布在整个单元格高度上
+func (c *ICell) getBaselines(lines []textLine) []int {
+	ys, h := c.getLineOffsets(lines)
+	top := c.getBlockPY(h)
+	if v := c.Style.Alignment.Vertical; (v == "justify" || v == "distributed") && len(ys) > 1 && h < c.Height {
+		for i := range ys {
+			ys[i] += (c.Height - h) * i / (len(ys) - 1)
+		}
+		top = 0
+	}
+	for i := range ys {
+		ys[i] += top
+	}
+	return ys
+}
+
+// getLineWidth 一行文本的宽度 按字体的字宽和字偶距计算, 复杂文字按塑形后的宽度
+func (c *ICell) getLineWidth(line textLine) int {
+	if sl := c.shapeLine(line); sl != nil {
+		return sl.width
+	}
+	w := 0
+	for _, r := range line {
+		w += measureText(c.getRunFace(r.Font), r.Text)
+	}
+	return w
+}
+
+// getBlockPY 文本块上边界的纵坐标 h 为文本块高度
+func (c *ICell) getBlockPY(h int) (y int) {
 	switch c.Style.Alignment.Vertical {
-	case "center":
-		y = c.Height/2 + c.getSize()
-	case "top":
-		y = int(float64(c.getSize()) * 2)
-	case "bottom", "":
-		y = c.Height - c.getSize()
+	case "center", "distributed":
+		y = (c.Height - h) / 2
+	case "top", "justify":
+		y = 0
+	default:
+		y = c.Height - h
 	}
 	return y
 }
 
-func (c *ICell) getValWidth() (w int) {
-	w = 0
-	rs := []rune(c.Value)
-	for _, s := range rs {
-		if unicode.Is(unicode.Han, s) {
-			w += int(float64(c.getSize()) * 3)
-			continue
+// getBeginPX 文本起点的横坐标 w 为文本宽度
+func (c *ICell) getBeginPX(w int) (x int) {
+	switch c.getHorizontal() {
+	case "center", "centerContinuous", "distributed":
+		x = (c.Width - w) / 2
+	case "right":
+		x = c.Width - w - cellPadding - c.getIndent()
+	default:
+		x = cellPadding + c.getIndent()
+	}
+	return x
+}
+
+// getTextWidth 单元格内可绘制文本的宽度
+func (c *ICell) getTextWidth() int {
+	w := c.Width - 2*cellPadding - c.getIndent()
+	if c.getHorizontal() == "distributed" {
+		// 分散对齐两侧都缩进
+		w -= c.getIndent()
+	}
+	return w
+}
+
+// getLines 按换行符拆分的文本行 设置了自动换行时再按单元格宽度折行
+// 单元格宽度未确定(为0)或文字旋转时不折行, 竖排时每个字符一行
+func (c *ICell) getLines() []textLine {
+	lines, _ := c.layoutLines()
+	return lines
+}
+
+// layoutLines 文本行及每一行是否为段落(换行符之间的文本)的最后一行
+func (c *ICell) layoutLines() (lines []textLine, ends []bool) {
+	if c.isStacked() {
+		for _, r := range c.getRuns() {
+			for _, ch := range r.Text {
+				if ch != '\n' && ch != '\r' {
+					lines = append(lines, textLine{{Text: string(ch), Font: r.Font}})
+					ends = append(ends, true)
+				}
+			}
+		}
+		return
+	}
+	for _, para := range splitRuns(c.getRuns()) {
+		text := para.String()
+		wrapped := [][2]int{{0, len(text)}}
+		switch {
+		case c.Width <= 0 || c.getRotation() != 0:
+		case c.getHorizontal() == "fill":
+			para = c.fillLine(para)
+			wrapped = [][2]int{{0, len(para.String())}}
+		case c.isWrap() && !c.isNumber():
+			wrapped = wrapText(text, c.getTextWidth(), func(start, end int) int {
+				return c.getLineWidth(sliceRuns(para, start, end))
+			})
 		}
-		if unicode.IsPunct(s) {
-			w += int(float64(c.getSize()) * 0.5)
-			continue
+		for i, rg := range wrapped {
+			lines = append(lines, sliceRuns(para, rg[0], rg[1]))
+			ends = append(ends, i == len(wrapped)-1)
 		}
-		w += c.getSize() * 2
 	}
 	return
 }
 
+// fillLine 填充对齐 重复文本直到填满单元格宽度, 放不下时只保留一份
+func (c *ICell) fillLine(line textLine) textLine {
+	w := c.getLineWidth(line)
+	if w <= 0 || w > c.getTextWidth() {
+		return line
+	}
+	filled := make(textLine, 0, len(line))
+	for i := 0; i < c.getTextWidth()/w; i++ {
+		filled = append(filled, line...)
+	}
+	return filled
+}
+
+// isStacked 是否为竖排文字
+func (c *ICell) isStacked() bool {
+	return c.Style.Alignment.TextRotation == stackedRotation
+}
+
+// getRotation 文字旋转的角度 逆时针为正
+// Excel 中 1-90 为逆时针旋转, 91-180 为顺时针旋转 (值-90) 度
+func (c *ICell) getRotation() int {
+	r := c.Style.Alignment.TextRotation
+	switch {
+	case r > 90 && r <= 180:
+		return 90 - r
+	case r > 0 && r <= 90:
+		return r
+	}
+	return 0
+}
+
+// getTextSize 未旋转时文本块的宽高
+func (c *ICell) getTextSize() (w, h int) {
+	lines := c.getLines()
+	for _, line := range lines {
+		w = maxInt(w, c.getLineWidth(line))
+	}
+	_, h = c.getLineOffsets(lines)
+	return
+}
+
+// getRotatedSize 旋转后文本块外接矩形的宽高
+func (c *ICell) getRotatedSize() (w, h int) {
+	tw, th := c.getTextSize()
+	rad := float64(c.getRotation()) * math.Pi / 180
+	sin, cos := math.Abs(math.Sin(rad)), math.Abs(math.Cos(rad))
+	w = int(math.Ceil(float64(tw)*cos + float64(th)*sin))
+	h = int(math.Ceil(float64(tw)*sin + float64(th)*cos))
+	return
+}
+
+// getValWidth 文本的实际宽度 按字体的字宽和字偶距计算, 多行时取最宽的一行, 旋转时为外接矩形的宽
+func (c *ICell) getValWidth() int {
+	if c.getRotation() != 0 {
+		w, _ := c.getRotatedSize()
+		return w
+	}
+	w, _ := c.getTextSize()
+	return w
+}
+
+// getAutoHeight Excel 自动行高
+func (c *ICell) getAutoHeight() int {
+	if c.getRotation() != 0 {
+		_, h := c.getRotatedSize()
+		return h + 2*cellPadding
+	}
+	h := 0
+	for _, line := range c.getLines() {
+		h += c.getLineMetrics(line).height
+	}
+	return h
+}
+
 func (c *ICell) getWh() (w, h int) {
 	w, h = 20, 20
-	w += c.getValWidth()
-	h += int(2 * float64(c.getSize()))
+	w += c.getValWidth() + c.getIndent()
+	if c.getRotation() != 0 {
+		_, rh := c.getRotatedSize()
+		h += rh
+		return
+	}
+	for i, line := range c.getLines() {
+		m := c.getLineMetrics(line)
+		if i == 0 {
+			h += 2 * m.size
+		} else {
+			h += m.height
+		}
+	}
 	return
 }
@@ -0,0 +1,396 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDateSerial Excel 能表示的最大日期 9999-12-31
+const maxDateSerial = 2958465
+
+// dateToken 日期时间格式中的一个元素
+type dateToken struct {
+	kind dateTokenKind
+	// n 元素的长度 如 mmm 为3, 小数秒的位数
+	n    int
+	text string
+}
+
+type dateTokenKind int
+
+const (
+	tokLiteral dateTokenKind = iota
+	tokYear
+	tokMonth
+	tokDay
+	tokHour
+	tokMinute
+	tokSecond
+	tokFraction
+	tokAmPm
+	tokElapsedHour
+	tokElapsedMinute
+	tokElapsedSecond
+	tokEra
+	tokEraName
+)
+
+// dateFields 序列号对应的日期和时间
+type dateFields struct {
+	year, month, day int
+	weekday          time.Weekday
+	hour, min, sec   int
+	// frac 不足一秒的部分
+	frac float64
+	// total 序列号对应的总秒数 用于经过的时间 [h] [m] [s]
+	total float64
+}
+
+var (
+	enMonths   = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	enWeekdays = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	zhMonths   = []string{"一月", "二月", "三月", "四月", "五月", "六月", "七月", "八月", "九月", "十月", "十一月", "十二月"}
+	zhWeekdays = []string{"日", "一", "二", "三", "四", "五", "六"}
+	jaWeekdays = []string{"日", "月", "火", "水", "木", "金", "土"}
+)
+
+// japaneseEras 日本的年号 按开始日期倒序
+var japaneseEras = []struct {
+	start       time.Time
+	letter      string
+	short, name string
+}{
+	{time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC), "R", "令", "令和"},
+	{time.Date(1989, 1, 8, 0, 0, 0, 0, time.UTC), "H", "平", "平成"},
+	{time.Date(1926, 12, 25, 0, 0, 0, 0, time.UTC), "S", "昭", "昭和"},
+	{time.Date(1912, 7, 30, 0, 0, 0, 0, time.UTC), "T", "大", "大正"},
+	{time.Date(1868, 1, 1, 0, 0, 0, 0, time.UTC), "M", "明", "明治"},
+}
+
+// formatDate 按日期时间格式 format 格式化 Excel 的日期序列号 serial
+// date1904 为工作簿使用的 1904 日期系统, 负数和超过 9999-12-31 的日期无法显示
+func formatDate(serial float64, format string, date1904 bool) (string, error) {
+	if serial < 0 || serial >= maxDateSerial+1 {
+		return "", errors.New("date serial out of range")
+	}
+	tokens, lcid := parseDateFormat(format)
+	// 按显示的最小单位四舍五入
+	digits := 0
+	hasAmPm := false
+	for _, t := range tokens {
+		switch t.kind {
+		case tokFraction:
+			digits = maxInt(digits, t.n)
+		case tokAmPm:
+			hasAmPm = true
+		}
+	}
+	unit := math.Pow(10, float64(digits))
+	total := math.Round(serial*86400*unit) / unit
+	f := serialDate(int(total/86400), date1904)
+	f.total = total
+	secs := total - float64(int(total/86400))*86400
+	f.hour, f.min, f.sec = int(secs)/3600, int(secs)%3600/60, int(secs)%60
+	f.frac = secs - math.Floor(secs)
+
+	var sb strings.Builder
+	for _, t := range tokens {
+		switch t.kind {
+		case tokLiteral:
+			sb.WriteString(t.text)
+		case tokYear:
+			if t.n <= 2 {
+				sb.WriteString(fmt.Sprintf("%02d", f.year%100))
+			} else {
+				sb.WriteString(fmt.Sprintf("%04d", f.year))
+			}
+		case tokMonth:
+			sb.WriteString(formatMonth(f.month, t.n, lcid))
+		case tokDay:
+			sb.WriteString(formatDay(f, t.n, lcid))
+		case tokHour:
+			h := f.hour
+			if hasAmPm {
+				if h = h % 12; h == 0 {
+					h = 12
+				}
+			}
+			sb.WriteString(padNumber(h, t.n))
+		case tokMinute:
+			sb.WriteString(padNumber(f.min, t.n))
+		case tokSecond:
+			sb.WriteString(padNumber(f.sec, t.n))
+		case tokFraction:
+			frac := strconv.FormatFloat(f.frac, 'f', t.n, 64)
+			sb.WriteString(strings.TrimPrefix(frac, "0"))
+		case tokAmPm:
+			parts := strings.SplitN(t.text, "/", 2)
+			if f.hour < 12 {
+				sb.WriteString(parts[0])
+			} else {
+				sb.WriteString(parts[1])
+			}
+		case tokElapsedHour:
+			sb.WriteString(padNumber(int(f.total/3600), t.n))
+		case tokElapsedMinute:
+			sb.WriteString(padNumber(int(f.total/60), t.n))
+		case tokElapsedSecond:
+			sb.WriteString(padNumber(int(f.total), t.n))
+		case tokEra:
+			sb.WriteString(padNumber(eraYear(f, lcid), t.n))
+		case tokEraName:
+			sb.WriteString(eraName(f, t.n, lcid))
+		}
+	}
+	return sb.String(), nil
+}
+
+// serialDate 日期序列号的整数部分对应的日期
+// 1900 日期系统沿用了 Lotus 1-2-3 的错误 把 1900 年当作闰年: 0 为 1900-01-00, 60 为 1900-02-29
+func serialDate(days int, date1904 bool) dateFields {
+	if date1904 {
+		t := time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, days)
+		return dateFields{year: t.Year(), month: int(t.Month()), day: t.Day(), weekday: t.Weekday()}
+	}
+	// 1900-03-01 之前的星期与 Excel 一致 按序列号推算
+	weekday := time.Weekday((days + 6) % 7)
+	switch {
+	case days == 0:
+		return dateFields{year: 1900, month: 1, day: 0, weekday: weekday}
+	case days == 60:
+		return dateFields{year: 1900, month: 2, day: 29, weekday: weekday}
+	case days < 60:
+		days++
+	}
+	t := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, days)
+	return dateFields{year: t.Year(), month: int(t.Month()), day: t.Day(), weekday: weekday}
+}
+
+// parseDateFormat 把日期时间格式拆分为元素 并返回 [$-404] 这样的区域标识
+func parseDateFormat(format string) (tokens []dateToken, lcid string) {
+	runes := []rune(format)
+	lower := []rune(strings.ToLower(format))
+	// count 从 i 开始连续的字符 r 的个数
+	count := func(i int, r rune) int {
+		n := 0
+		for i+n < len(lower) && lower[i+n] == r {
+			n++
+		}
+		return n
+	}
+	literal := func(s string) {
+		if n := len(tokens); n > 0 && tokens[n-1].kind == tokLiteral {
+			tokens[n-1].text += s
+			return
+		}
+		tokens = append(tokens, dateToken{kind: tokLiteral, text: s})
+	}
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+		switch c := lower[i]; {
+		case c == '"':
+			end := strings.IndexRune(string(runes[i+1:]), '"')
+			if end < 0 {
+				literal(string(runes[i+1:]))
+				return
+			}
+			quoted := string(runes[i+1:])[:end]
+			literal(quoted)
+			i += utf8.RuneCountInString(quoted) + 2
+		case c == '\\':
+			if i+1 < len(runes) {
+				literal(string(runes[i+1]))
+			}
+			i += 2
+		case c == '_':
+			// 留出下一个字符的宽度
+			literal(" ")
+			i += 2
+		case c == '*':
+			// 重复填充的字符 日期格式中忽略
+			i += 2
+		case c == '[':
+			end := strings.IndexRune(rest, ']')
+			if end < 0 {
+				literal(rest)
+				return
+			}
+			inner := strings.ToLower(rest[1:end])
+			i += utf8.RuneCountInString(rest[:end+1])
+			switch {
+			case inner != "" && strings.Trim(inner, "h") == "":
+				tokens = append(tokens, dateToken{kind: tokElapsedHour, n: len(inner)})
+			case inner != "" && strings.Trim(inner, "m") == "":
+				tokens = append(tokens, dateToken{kind: tokElapsedMinute, n: len(inner)})
+			case inner != "" && strings.Trim(inner, "s") == "":
+				tokens = append(tokens, dateToken{kind: tokElapsedSecond, n: len(inner)})
+			case strings.HasPrefix(inner, "$"):
+				// [$-404] 区域, [$¥-804] 货币符号和区域
+				sym, id := inner[1:], ""
+				if dash := strings.IndexRune(sym, '-'); dash >= 0 {
+					sym, id = rest[2:2+dash], sym[dash+1:]
+				}
+				literal(sym)
+				lcid = strings.TrimLeft(id, "0")
+			}
+			// 颜色和条件不影响日期的文字
+		case strings.HasPrefix(strings.ToLower(rest), "am/pm"):
+			tokens = append(tokens, dateToken{kind: tokAmPm, text: rest[0:2] + "/" + rest[3:5]})
+			i += 5
+		case strings.HasPrefix(strings.ToLower(rest), "a/p"):
+			tokens = append(tokens, dateToken{kind: tokAmPm, text: rest[0:3]})
+			i += 3
+		case strings.HasPrefix(rest, "上午/下午"):
+			tokens = append(tokens, dateToken{kind: tokAmPm, text: "上午/下午"})
+			i += 5
+		case c == 'y', c == 'm', c == 'd', c == 'h', c == 'e', c == 'g':
+			n := count(i, c)
+			kind := map[rune]dateTokenKind{'y': tokYear, 'm': tokMonth, 'd': tokDay, 'h': tokHour, 'e': tokEra, 'g': tokEraName}[c]
+			if kind == tokHour {
+				// hhh 与 hh 相同
+				n = minInt(n, 2)
+			}
+			tokens = append(tokens, dateToken{kind: kind, n: n})
+			i += count(i, c)
+		case c == 's':
+			n := count(i, c)
+			tokens = append(tokens, dateToken{kind: tokSecond, n: minInt(n, 2)})
+			i += n
+			// 秒之后的 .0 .00 .000 为小数秒
+			if i+1 < len(runes) && runes[i] == '.' && runes[i+1] == '0' {
+				digits := count(i+1, '0')
+				tokens = append(tokens, dateToken{kind: tokFraction, n: digits})
+				i += digits + 1
+			}
+		case c == 'b' && i+1 < len(runes) && (runes[i+1] == '1' || runes[i+1] == '2'):
+			// 日历 b1 公历, b2 回历 都按公历显示
+			i += 2
+		default:
+			literal(string(runes[i]))
+			i++
+		}
+	}
+	resolveMinutes(tokens)
+	return tokens, lcid
+}
+
+// resolveMinutes m 和 mm 紧跟在小时之后或在秒之前时表示分钟
+func resolveMinutes(tokens []dateToken) {
+	// neighbor 从 i 向 step 方向最近的非文字元素
+	neighbor := func(i, step int) dateTokenKind {
+		for j := i + step; j >= 0 && j < len(tokens); j += step {
+			if tokens[j].kind != tokLiteral {
+				return tokens[j].kind
+			}
+		}
+		return tokLiteral
+	}
+	for i, t := range tokens {
+		if t.kind != tokMonth || t.n > 2 {
+			continue
+		}
+		prev, next := neighbor(i, -1), neighbor(i, 1)
+		if prev == tokHour || prev == tokElapsedHour || next == tokSecond || next == tokElapsedSecond {
+			tokens[i].kind = tokMinute
+		}
+	}
+}
+
+func padNumber(v, n int) string {
+	if n >= 2 {
+		return fmt.Sprintf("%0*d", n, v)
+	}
+	return strconv.Itoa(v)
+}
+
+// formatMonth 月份 m mm 为数字, mmm mmmm 为缩写和全称, mmmmm 为首字母
+// 中文和日文区域的月份名称带有"月"
+func formatMonth(month, n int, lcid string) string {
+	switch {
+	case n <= 2:
+		return padNumber(month, n)
+	case lcid == "804" || lcid == "404":
+		if n == 3 {
+			return strconv.Itoa(month) + "月"
+		}
+		return zhMonths[month-1]
+	case lcid == "411" || lcid == "412":
+		return strconv.Itoa(month) + "月"
+	case n == 3:
+		return enMonths[month-1][:3]
+	case n == 4:
+		return enMonths[month-1]
+	}
+	return enMonths[month-1][:1]
+}
+
+// formatDay 日 d dd 为数字, ddd dddd 为星期的缩写和全称
+func formatDay(f dateFields, n int, lcid string) string {
+	wd := int(f.weekday)
+	switch {
+	case n <= 2:
+		return padNumber(f.day, n)
+	case lcid == "804":
+		if n == 3 {
+			return "周" + zhWeekdays[wd]
+		}
+		return "星期" + zhWeekdays[wd]
+	case lcid == "404":
+		if n == 3 {
+			return "週" + zhWeekdays[wd]
+		}
+		return "星期" + zhWeekdays[wd]
+	case lcid == "411":
+		if n == 3 {
+			return jaWeekdays[wd]
+		}
+		return jaWeekdays[wd] + "曜日"
+	case n == 3:
+		return enWeekdays[wd][:3]
+	}
+	return enWeekdays[wd]
+}
+
+// eraYear 纪年 [$-404] 为民国纪年, [$-411] 为日本年号纪年, 其他区域为公历年份
+func eraYear(f dateFields, lcid string) int {
+	switch lcid {
+	case "404":
+		return f.year - 1911
+	case "411":
+		t := time.Date(f.year, time.Month(f.month), f.day, 0, 0, 0, 0, time.UTC)
+		for _, era := range japaneseEras {
+			if !t.Before(era.start) {
+				return f.year - era.start.Year() + 1
+			}
+		}
+	}
+	return f.year
+}
+
+// eraName 日本年号 g 为字母, gg 为首字, ggg 为全称
+func eraName(f dateFields, n int, lcid string) string {
+	if lcid == "404" {
+		return "民國"
+	}
+	if lcid != "411" {
+		return ""
+	}
+	t := time.Date(f.year, time.Month(f.month), f.day, 0, 0, 0, 0, time.UTC)
+	for _, era := range japaneseEras {
+		if !t.Before(era.start) {
+			switch n {
+			case 1:
+				return era.letter
+			case 2:
+				return era.short
+			}
+			return era.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,268 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"math"
+)
+
+// Excel 列宽以默认字体(Calibri 11)在96DPI下最大数字宽度的字符数为单位, 行高以磅为单位
+const (
+	maxDigitWidth = 7
+	// defaultColWidth 默认列宽 含单元格两侧边距, 对应 baseColWidth 为8
+	defaultColWidth     = 9.140625
+	defaultBaseColWidth = 8
+	defaultRowHeight    = 15
+	// autoRowHeightRate 自动行高与字号的比例 如11号字为15磅
+	autoRowHeightRate = 1.3125
+)
+
+// sheetDims 工作表的列宽行高
+type sheetDims struct {
+	file  *excelize.File
+	sheet string
+	cols  []xlsxCol
+	// rows 定义了属性的行
+	rows map[int]xlsxRowAttr
+	// heights 已读取的行高 为0时使用默认行高
+	heights          map[int]float64
+	defaultColWidth  float64
+	defaultRowHeight float64
+	// fixedRowHeight 默认行高为自定义行高 不随字号增高
+	fixedRowHeight bool
+	// zeroHeight 未定义的行默认隐藏
+	zeroHeight bool
+	// summaryBelow 分级显示的汇总行在明细下方
+	summaryBelow bool
+	// summaryRight 分级显示的汇总列在明细右侧
+	summaryRight bool
+	hiddenRows   map[int]bool
+	hiddenCols   map[int]bool
+}
+
+func newSheetDims(file *excelize.File, sheet string) (*sheetDims, error) {
+	var (
+		baseColWidth excelize.BaseColWidth
+		defColWidth  excelize.DefaultColWidth
+		defRowHeight excelize.DefaultRowHeight
+		customHeight excelize.CustomHeight
+		zeroHeight   excelize.ZeroHeight
+		summaryBelow excelize.OutlineSummaryBelow
+		err          error
+		dims         = &sheetDims{file: file, sheet: sheet, heights: map[int]float64{}}
+	)
+	if err = file.GetSheetFormatPr(sheet, &baseColWidth, &defColWidth, &defRowHeight, &customHeight, &zeroHeight); err != nil {
+		return nil, err
+	}
+	if err = file.GetSheetPrOptions(sheet, &summaryBelow); err != nil {
+		return nil, err
+	}
+	ws, err := readWorksheet(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	if err = dims.readCols(ws.Cols.Col); err != nil {
+		return nil, err
+	}
+	if err = dims.readRows(ws.SheetData.Row); err != nil {
+		return nil, err
+	}
+	dims.defaultColWidth = float64(defColWidth)
+	if dims.defaultColWidth == 0 {
+		dims.defaultColWidth = defaultColWidth
+		if baseColWidth > 0 {
+			// baseColWidth 不含边距
+			dims.defaultColWidth = float64(baseColWidth) + defaultColWidth - defaultBaseColWidth
+		}
+	}
+	dims.defaultRowHeight = float64(defRowHeight)
+	dims.fixedRowHeight = bool(customHeight)
+	if dims.defaultRowHeight == 0 {
+		dims.defaultRowHeight = defaultRowHeight
+	}
+	dims.zeroHeight = bool(zeroHeight)
+	dims.summaryBelow = bool(summaryBelow)
+	dims.summaryRight = ws.SheetPr.OutlinePr.SummaryRight == nil || *ws.SheetPr.OutlinePr.SummaryRight
+	dims.collapse()
+	return dims, nil
+}
+
+// readCols 读取定义了属性的列的宽度, 隐藏和层级 同一定义中的列属性相同
+func (s *sheetDims) readCols(cols []xlsxCol) error {
+	for i := range cols {
+		c := &cols[i]
+		name, err := excelize.ColumnNumberToName(c.Min)
+		if err != nil {
+			return err
+		}
+		// 未设置宽度时 excelize 返回它的默认列宽, 这里使用工作表的默认列宽
+		if c.Width > 0 {
+			if c.Width, err = s.file.GetColWidth(s.sheet, name); err != nil {
+				return err
+			}
+		}
+		visible, err := s.file.GetColVisible(s.sheet, name)
+		if err != nil {
+			return err
+		}
+		// 自定义宽度为0的列隐藏
+		c.Hidden = !visible || (c.CustomWidth && c.Width == 0)
+		if c.OutlineLevel, err = s.file.GetColOutlineLevel(s.sheet, name); err != nil {
+			return err
+		}
+	}
+	s.cols = cols
+	return nil
+}
+
+// readRows 读取定义了属性的行的隐藏和层级 行高数量多时读取较慢, 在 rowHeight 中按需读取
+func (s *sheetDims) readRows(rows []xlsxRowAttr) error {
+	s.rows = make(map[int]xlsxRowAttr, len(rows))
+	prev := 0
+	for _, r := range rows {
+		// 省略行号时为上一行的下一行
+		if r.R == 0 {
+			r.R = prev + 1
+		}
+		prev = r.R
+		visible, err := s.file.GetRowVisible(s.sheet, r.R)
+		if err != nil {
+			return err
+		}
+		// 自定义行高为0的行隐藏
+		r.Hidden = !visible || (r.CustomHeight && r.Ht == 0)
+		if r.OutlineLevel, err = s.file.GetRowOutlineLevel(s.sheet, r.R); err != nil {
+			return err
+		}
+		s.rows[r.R] = r
+	}
+	return nil
+}
+
+// collapse 标记折叠的分级显示中的行列为隐藏
+// 一般折叠的明细行列本身已带有 hidden 属性, 这里补充只在汇总行列上标记了 collapsed 的情况
+func (s *sheetDims) collapse() {
+	s.hiddenRows, s.hiddenCols = map[int]bool{}, map[int]bool{}
+	rowLevel := func(i int) uint8 {
+		return s.rows[i].OutlineLevel
+	}
+	for i, r := range s.rows {
+		if r.Collapsed {
+			collapseGroup(s.hiddenRows, i, rowLevel, s.summaryBelow)
+		}
+	}
+	colLevel := func(i int) uint8 {
+		if c := s.col(i); c != nil {
+			return c.OutlineLevel
+		}
+		return 0
+	}
+	for _, c := range s.cols {
+		if !c.Collapsed {
+			continue
+		}
+		for i := c.Min; i <= c.Max; i++ {
+			collapseGroup(s.hiddenCols, i, colLevel, s.summaryRight)
+		}
+	}
+}
+
+// collapseGroup 隐藏汇总行列 summary 相邻的明细组, before 为true时明细组在汇总之前
+func collapseGroup(hidden map[int]bool, summary int, level func(int) uint8, before bool) {
+	lv := level(summary)
+	step := 1
+	if before {
+		step = -1
+	}
+	// 按方向没有更深层级的明细时 尝试另一侧
+	if level(summary+step) <= lv {
+		step = -step
+	}
+	for i := summary + step; i > 0 && level(i) > lv; i += step {
+		hidden[i] = true
+	}
+}
+
+// rowHidden 行是否隐藏
+func (s *sheetDims) rowHidden(row int) bool {
+	r, ok := s.rows[row]
+	if !ok {
+		return s.zeroHeight
+	}
+	return r.Hidden || s.hiddenRows[row]
+}
+
+// colHidden 列是否隐藏
+func (s *sheetDims) colHidden(col int) bool {
+	if c := s.col(col); c != nil && c.Hidden {
+		return true
+	}
+	return s.hiddenCols[col]
+}
+
+// visible 去掉隐藏的行列
+func (s *sheetDims) visible(g *Grid) *Grid {
+	vg := &Grid{Sheet: g.Sheet, Rows: make([]int, 0, len(g.Rows)), Cols: make([]int, 0, len(g.Cols))}
+	for _, r := range g.Rows {
+		if !s.rowHidden(r) {
+			vg.Rows = append(vg.Rows, r)
+		}
+	}
+	for _, c := range g.Cols {
+		if !s.colHidden(c) {
+			vg.Cols = append(vg.Cols, c)
+		}
+	}
+	return vg
+}
+
+// col 列定义 没有时返回nil
+func (s *sheetDims) col(col int) *xlsxCol {
+	for i := range s.cols {
+		if s.cols[i].Min <= col && col <= s.cols[i].Max {
+			return &s.cols[i]
+		}
+	}
+	return nil
+}
+
+// colWidth 列宽像素
+func (s *sheetDims) colWidth(col int) int {
+	width := s.defaultColWidth
+	if c := s.col(col); c != nil && c.Width > 0 {
+		width = c.Width
+	}
+	return colWidthToPixels(width)
+}
+
+// rowHeight 行高像素 fixed 为false时行高可随内容增高
+func (s *sheetDims) rowHeight(row int) (h int, fixed bool) {
+	if ht := s.rowPoints(row); ht > 0 {
+		return pointsToPixels(ht), true
+	}
+	return pointsToPixels(s.defaultRowHeight), s.fixedRowHeight
+}
+
+// rowPoints 行设置的行高(磅) 未设置时为0
+// 未设置行高时 excelize 返回它的默认行高, 只对设置了行高的行调用接口
+func (s *sheetDims) rowPoints(row int) float64 {
+	if r, ok := s.rows[row]; !ok || r.Ht == 0 {
+		return 0
+	}
+	ht, ok := s.heights[row]
+	if !ok {
+		ht, _ = s.file.GetRowHeight(s.sheet, row)
+		s.heights[row] = ht
+	}
+	return ht
+}
+
+// colWidthToPixels 列宽(字符数)转为绘制像素
+func colWidthToPixels(width float64) int {
+	px := math.Trunc(((256*width + math.Trunc(128/maxDigitWidth)) / 256) * maxDigitWidth)
+	return int(px * renderDPI / 96)
+}
+
+// pointsToPixels 磅转为绘制像素
+func pointsToPixels(pt float64) int {
+	return int(math.Round(pt * renderDPI / 72))
+}
@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/image/font/gofont/goregular"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testFonts 只含 Go Regular 的字体注册表
+func testFonts(t *testing.T) *FontRegistry {
+	t.Helper()
+	fonts := NewFontRegistry()
+	if err := fonts.LoadBytes(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	return fonts
+}
+
+func TestNewSheetDimsInMemory(t *testing.T) {
+	const sheet = "Sheet1"
+	tests := []struct {
+		name   string
+		setup  func(f *excelize.File) error
+		row    bool
+		index  int
+		hidden bool
+		px     int
+	}{
+		{"default column", func(f *excelize.File) error { return nil }, false, 1, false, 96},
+		{"column width", func(f *excelize.File) error { return f.SetColWidth(sheet, "B", "C", 20) }, false, 3, false, 210},
+		{"zero width column", func(f *excelize.File) error { return f.SetColWidth(sheet, "B", "B", 0) }, false, 2, true, 96},
+		{"hidden column", func(f *excelize.File) error { return f.SetColVisible(sheet, "D", false) }, false, 4, true, 96},
+		{"hidden column keeps width", func(f *excelize.File) error {
+			if err := f.SetColWidth(sheet, "D", "D", 20); err != nil {
+				return err
+			}
+			return f.SetColVisible(sheet, "D", false)
+		}, false, 4, true, 210},
+		{"default row", func(f *excelize.File) error { return f.SetCellValue(sheet, "A3", 1) }, true, 3, false, 30},
+		{"row height", func(f *excelize.File) error { return f.SetRowHeight(sheet, 2, 40) }, true, 2, false, 80},
+		{"zero height row", func(f *excelize.File) error { return f.SetRowHeight(sheet, 2, 0) }, true, 2, true, 30},
+		{"hidden row", func(f *excelize.File) error { return f.SetRowVisible(sheet, 3, false) }, true, 3, true, 30},
+		{"hidden row keeps height", func(f *excelize.File) error {
+			if err := f.SetRowHeight(sheet, 3, 40); err != nil {
+				return err
+			}
+			return f.SetRowVisible(sheet, 3, false)
+		}, true, 3, true, 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := excelize.NewFile()
+			if err := tt.setup(f); err != nil {
+				t.Fatal(err)
+			}
+			dims, err := newSheetDims(f, sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hidden, px := dims.colHidden(tt.index), dims.colWidth(tt.index)
+			if tt.row {
+				hidden = dims.rowHidden(tt.index)
+				px, _ = dims.rowHeight(tt.index)
+			}
+			if hidden != tt.hidden || px != tt.px {
+				t.Errorf("hidden %v size %d, want %v %d", hidden, px, tt.hidden, tt.px)
+			}
+		})
+	}
+}
+
+// 在内存中修改后直接转换 不经过保存
+func TestDrawExcelInMemory(t *testing.T) {
+	const sheet = "Sheet1"
+	f := excelize.NewFile()
+	for _, err := range []error{
+		f.SetCellValue(sheet, "A1", "a"),
+		f.SetCellValue(sheet, "B1", "b"),
+		f.SetCellValue(sheet, "C1", "c"),
+		f.SetCellValue(sheet, "D1", "d"),
+		f.SetColWidth(sheet, "A", "A", 20),
+		f.SetColWidth(sheet, "B", "B", 0),
+		f.SetColVisible(sheet, "C", false),
+		f.SetRowHeight(sheet, 1, 40),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &Ex2Img{Range: "A1:D1", Fonts: testFonts(t)}
+	rgba, err := d.DrawExcel(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A 列宽20, D 列默认列宽, B C 隐藏, 右侧和底部多1像素的边框
+	if w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy(); w != 210+96+1 || h != 80+1 {
+		t.Errorf("size %dx%d, want %dx%d", w, h, 210+96+1, 80+1)
+	}
+}
+
+// openSheetXML 打开 Sheet1 内容为 sheetXML 的工作簿 用于 excelize 没有写入接口的属性
+func openSheetXML(t *testing.T, sheetXML string) *excelize.File {
+	t.Helper()
+	return openWorkbookParts(t, map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sheetXML + `</worksheet>`,
+	})
+}
+
+// openWorkbookParts 打开新建的工作簿 包内的部件替换或添加为 parts
+func openWorkbookParts(t *testing.T, parts map[string]string) *excelize.File {
+	t.Helper()
+	buf, err := excelize.NewFile().WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	zw := zip.NewWriter(out)
+	write := func(name string, r io.Reader) {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, zf := range zr.File {
+		if _, ok := parts[zf.Name]; ok {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(zf.Name, rc)
+		rc.Close()
+	}
+	for name, content := range parts {
+		write(name, strings.NewReader(content))
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestNewSheetDimsCollapsed(t *testing.T) {
+	// B 到 D 列为明细
+	const colGroup = `<col min="2" max="4" width="9" customWidth="1" outlineLevel="1"/>`
+	tests := []struct {
+		name   string
+		xml    string
+		setup  func(f *excelize.File) error
+		rows   []int
+		cols   []int
+		hidden []bool
+	}{
+		{
+			name:   "summary row below",
+			xml:    `<sheetData><row r="1"/><row r="2" outlineLevel="1"/><row r="3" outlineLevel="2"/><row r="4" outlineLevel="1"/><row r="5" collapsed="1"/></sheetData>`,
+			rows:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "summary row above",
+			xml:    `<sheetPr><outlinePr summaryBelow="0"/></sheetPr><sheetData><row r="1" collapsed="1"/><row r="2" outlineLevel="1"/><row r="3" outlineLevel="2"/><row r="4" outlineLevel="1"/><row r="5"/></sheetData>`,
+			rows:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "expanded rows",
+			xml:    `<sheetData><row r="1"/><row r="2" outlineLevel="1"/><row r="3" outlineLevel="2"/><row r="4" outlineLevel="1"/><row r="5"/></sheetData>`,
+			rows:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, false, false, false, false},
+		},
+		{
+			name:   "inner row group",
+			xml:    `<sheetData><row r="1"/><row r="2" outlineLevel="1"/><row r="3" outlineLevel="2"/><row r="4" outlineLevel="1" collapsed="1"/><row r="5"/></sheetData>`,
+			rows:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, false, true, false, false},
+		},
+		{
+			name: "row group grown in memory",
+			xml:  `<sheetData><row r="1"/><row r="2" outlineLevel="1"/><row r="3" outlineLevel="1"/><row r="4"/><row r="5" collapsed="1"/></sheetData>`,
+			setup: func(f *excelize.File) error {
+				return f.SetRowOutlineLevel("Sheet1", 4, 1)
+			},
+			rows:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "summary column right",
+			xml:    `<cols>` + colGroup + `<col min="5" max="5" width="9" customWidth="1" collapsed="1"/></cols><sheetData/>`,
+			cols:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "summary column left",
+			xml:    `<sheetPr><outlinePr summaryRight="0"/></sheetPr><cols><col min="1" max="1" width="9" customWidth="1" collapsed="1"/>` + colGroup + `</cols><sheetData/>`,
+			cols:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "summary column left ignored when details are on the right",
+			xml:    `<sheetPr><outlinePr summaryRight="0"/></sheetPr><cols>` + colGroup + `<col min="5" max="5" width="9" customWidth="1" collapsed="1"/></cols><sheetData/>`,
+			cols:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+		{
+			name:   "expanded columns",
+			xml:    `<cols>` + colGroup + `</cols><sheetData/>`,
+			cols:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, false, false, false, false},
+		},
+		{
+			name: "column group grown in memory",
+			xml:  `<cols><col min="2" max="3" width="9" customWidth="1" outlineLevel="1"/><col min="5" max="5" width="9" customWidth="1" collapsed="1"/></cols><sheetData/>`,
+			setup: func(f *excelize.File) error {
+				return f.SetColOutlineLevel("Sheet1", "D", 1)
+			},
+			cols:   []int{1, 2, 3, 4, 5},
+			hidden: []bool{false, true, true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := openSheetXML(t, tt.xml)
+			if tt.setup != nil {
+				if err := tt.setup(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dims, err := newSheetDims(f, "Sheet1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, r := range tt.rows {
+				if got := dims.rowHidden(r); got != tt.hidden[i] {
+					t.Errorf("row %d hidden %v, want %v", r, got, tt.hidden[i])
+				}
+			}
+			for i, c := range tt.cols {
+				if got := dims.colHidden(c); got != tt.hidden[i] {
+					t.Errorf("col %d hidden %v, want %v", c, got, tt.hidden[i])
+				}
+			}
+		})
+	}
+}
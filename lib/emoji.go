@@ -0,0 +1,269 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	otfont "github.com/go-text/typesetting/font"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"unicode"
+)
+
+// 彩色表情 支持 CBDT/CBLC 和 sbix 位图字形, COLR/CPAL(版本0) 分层矢量字形
+// 没有注册彩色字体时使用后备字体中的单色字形
+
+// emojiPresentation 默认显示为彩色表情的字符 有彩色字体时优先使用彩色字体
+var emojiPresentation = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x231a, 0x231b, 1}, {0x23e9, 0x23ec, 1}, {0x23f0, 0x23f0, 1}, {0x23f3, 0x23f3, 1}, {0x25fd, 0x25fe, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267f, 0x267f, 1}, {0x2693, 0x2693, 1}, {0x26a1, 0x26a1, 1}, {0x26aa, 0x26ab, 1}, {0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1}, {0x26ce, 0x26ce, 1}, {0x26d4, 0x26d4, 1}, {0x26ea, 0x26ea, 1}, {0x26f2, 0x26f3, 1}, {0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1}, {0x26fd, 0x26fd, 1}, {0x2705, 0x2705, 1}, {0x270a, 0x270b, 1}, {0x2728, 0x2728, 1}, {0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1}, {0x2795, 0x2797, 1}, {0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f004, 0x1f004, 1}, {0x1f0cf, 0x1f0cf, 1}, {0x1f18e, 0x1f18e, 1}, {0x1f191, 0x1f19a, 1},
+		{0x1f1e6, 0x1f1ff, 1}, {0x1f201, 0x1f251, 1}, {0x1f300, 0x1f64f, 1}, {0x1f680, 0x1f6ff, 1},
+		{0x1f7e0, 0x1f7f0, 1}, {0x1f90c, 0x1f9ff, 1}, {0x1fa70, 0x1faff, 1},
+	},
+}
+
+// emojiSequence 组成表情序列的字符 零宽连接符, 键帽, 区域旗帜, 肤色和标签 需要按字体的连字塑形
+var emojiSequence = &unicode.RangeTable{
+	R16: []unicode.Range16{{0x200d, 0x200d, 1}, {0x20e3, 0x20e3, 1}},
+	R32: []unicode.Range32{{0x1f1e6, 0x1f1ff, 1}, {0x1f3fb, 0x1f3ff, 1}, {0xe0020, 0xe007f, 1}},
+}
+
+// isIgnorable 不显示的格式字符 零宽字符, 变体选择符和标签
+func isIgnorable(r rune) bool {
+	return (r >= 0x200b && r <= 0x200f) || (r >= 0x2060 && r <= 0x2064) || (r >= 0xfe00 && r <= 0xfe0f) ||
+		r == 0xfeff || (r >= 0xe0000 && r <= 0xe0fff)
+}
+
+func isEmoji(r rune) bool {
+	return unicode.Is(emojiPresentation, r)
+}
+
+// colrTable COLR 表(版本0) 和 CPAL 表的第一个调色板
+type colrTable struct {
+	// bases 基础字形对应的图层 [第一个图层, 图层数]
+	bases  map[otfont.GID][2]int
+	layers []colrLayer
+	colors []color.RGBA
+}
+
+type colrLayer struct {
+	gid otfont.GID
+	// palette 调色板中的颜色 0xffff 为文字颜色
+	palette uint16
+}
+
+// parseColr 解析 COLR 和 CPAL 表 没有或格式不正确时返回nil
+func parseColr(colr, cpal []byte) *colrTable {
+	if len(colr) < 14 || len(cpal) < 12 {
+		return nil
+	}
+	u16 := func(b []byte, i int) int { return int(binary.BigEndian.Uint16(b[i:])) }
+	u32 := func(b []byte, i int) int { return int(binary.BigEndian.Uint32(b[i:])) }
+	t := &colrTable{bases: map[otfont.GID][2]int{}}
+	numBase, baseOffset, layerOffset, numLayers := u16(colr, 2), u32(colr, 4), u32(colr, 8), u16(colr, 12)
+	if baseOffset+6*numBase > len(colr) || layerOffset+4*numLayers > len(colr) {
+		return nil
+	}
+	for i := 0; i < numBase; i++ {
+		rec := baseOffset + 6*i
+		t.bases[otfont.GID(u16(colr, rec))] = [2]int{u16(colr, rec+2), u16(colr, rec+4)}
+	}
+	for i := 0; i < numLayers; i++ {
+		rec := layerOffset + 4*i
+		t.layers = append(t.layers, colrLayer{gid: otfont.GID(u16(colr, rec)), palette: uint16(u16(colr, rec+2))})
+	}
+	numEntries, numRecords, recordsOffset := u16(cpal, 2), u16(cpal, 6), u32(cpal, 8)
+	first := u16(cpal, 12)
+	if recordsOffset+4*numRecords > len(cpal) || first+numEntries > numRecords {
+		return nil
+	}
+	for i := 0; i < numEntries; i++ {
+		rec := recordsOffset + 4*(first+i)
+		// BGRA 非预乘
+		c := color.NRGBA{B: cpal[rec], G: cpal[rec+1], R: cpal[rec+2], A: cpal[rec+3]}
+		t.colors = append(t.colors, color.RGBAModel.Convert(c).(color.RGBA))
+	}
+	return t
+}
+
+// isColorFont 字体是否有彩色字形
+func (r *FontRegistry) isColorFont(ft *truetype.Font) bool {
+	src := r.source(ft)
+	return src != nil && src.color
+}
+
+// isBitmapFont 字体是否只有位图字形 freetype 无法读取这样的字体的字形
+func (r *FontRegistry) isBitmapFont(ft *truetype.Font) bool {
+	src := r.source(ft)
+	return src != nil && src.bitmap
+}
+
+// hasGlyph 字体是否有字符 r 的字形
+// freetype 只能读取部分格式的字符映射表, 彩色字体另外按 go-text 读取的字符映射表查找
+func (r *FontRegistry) hasGlyph(ft *truetype.Font, ch rune) bool {
+	if ft.Index(ch) != 0 {
+		return true
+	}
+	src := r.source(ft)
+	if src == nil || !src.color {
+		return false
+	}
+	src.parse()
+	if src.font == nil {
+		return false
+	}
+	_, ok := src.font.NominalGlyph(ch)
+	return ok
+}
+
+// colorTable 字体的 COLR 表 没有时返回nil
+func (r *FontRegistry) colorTable(ft *truetype.Font) *colrTable {
+	src := r.source(ft)
+	if src == nil || !src.color {
+		return nil
+	}
+	src.parse()
+	return src.colr
+}
+
+func nominalGlyph(face *otfont.Face, r rune) otfont.GID {
+	gid, _ := face.NominalGlyph(r)
+	return gid
+}
+
+// hasColorGlyphs 文本段中是否有使用彩色字体绘制的字符
+func (c *ICell) hasColorGlyphs(r *IRun) bool {
+	face := c.getRunFace(r.Font).(*fallbackFace)
+	for _, ch := range r.Text {
+		if c.fonts.isColorFont(face.glyphFor(ch).ft) {
+			return true
+		}
+	}
+	return false
+}
+
+// drawColorGlyph 在基线原点 dot 处绘制字体 ft 的彩色字形 size 为字号的像素大小
+// 字形没有彩色版本时返回false 由调用方绘制单色字形
+func (c *ICell) drawColorGlyph(dst draw.Image, ft *truetype.Font, face *otfont.Face, gid otfont.GID, size fixed.Int26_6, dot fixed.Point26_6, fg color.Color) bool {
+	if face == nil || !c.fonts.isColorFont(ft) {
+		return false
+	}
+	scale := float32(size) / 64 / float32(face.Upem())
+	if colr := c.fonts.colorTable(ft); colr != nil {
+		if base, ok := colr.bases[gid]; ok && base[0]+base[1] <= len(colr.layers) {
+			for _, layer := range colr.layers[base[0] : base[0]+base[1]] {
+				outline, ok := face.GlyphData(layer.gid).(otfont.GlyphOutline)
+				if !ok {
+					continue
+				}
+				mask, at := rasterizeOutline(outline, scale, dot.X, dot.Y, false)
+				if mask == nil {
+					continue
+				}
+				col := fg
+				if int(layer.palette) < len(colr.colors) {
+					col = colr.colors[layer.palette]
+				}
+				draw.DrawMask(dst, mask.Bounds().Add(at), image.NewUniform(col), image.Point{}, mask, image.Point{}, draw.Over)
+			}
+			return true
+		}
+	}
+	// 选择最接近字号的位图尺寸 缩放到字号大小
+	ppem := uint16(size.Round())
+	face.SetPpem(ppem, ppem)
+	bm, ok := face.GlyphData(gid).(otfont.GlyphBitmap)
+	if !ok || bm.Format != otfont.PNG {
+		return false
+	}
+	img, err := png.Decode(bytes.NewReader(bm.Data))
+	if err != nil {
+		return false
+	}
+	ext, ok := face.GlyphExtents(gid)
+	if !ok {
+		return false
+	}
+	ox, oy := float64(dot.X)/64, float64(dot.Y)/64
+	s := float64(scale)
+	rect := image.Rect(
+		int(math.Round(ox+float64(ext.XBearing)*s)), int(math.Round(oy-float64(ext.YBearing)*s)),
+		int(math.Round(ox+float64(ext.XBearing+ext.Width)*s)), int(math.Round(oy-float64(ext.YBearing+ext.Height)*s)),
+	)
+	if rect.Empty() {
+		return false
+	}
+	draw.BiLinear.Scale(dst, rect, img, img.Bounds(), draw.Over, nil)
+	return true
+}
+
+// bitmapFace 只有位图字形的字体(如 Noto Color Emoji) 的 font.Face
+// freetype 无法读取这种字体的字形, 度量由 go-text 提供, 字形由 drawColorGlyph 绘制
+type bitmapFace struct {
+	face *otfont.Face
+	// scale 每个字体单位的像素
+	scale float64
+}
+
+func newBitmapFace(face *otfont.Face, ppem float64) *bitmapFace {
+	return &bitmapFace{face: face, scale: ppem / float64(face.Upem())}
+}
+
+func (f *bitmapFace) px(v float32) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(float64(v) * f.scale * 64))
+}
+
+func (f *bitmapFace) Close() error {
+	return nil
+}
+
+func (f *bitmapFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	advance, _ = f.GlyphAdvance(r)
+	return image.Rectangle{}, nil, image.Point{}, advance, false
+}
+
+func (f *bitmapFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	gid, ok := f.face.NominalGlyph(r)
+	if !ok {
+		return bounds, 0, false
+	}
+	if ext, ok := f.face.GlyphExtents(gid); ok {
+		bounds.Min = fixed.Point26_6{X: f.px(ext.XBearing), Y: -f.px(ext.YBearing)}
+		bounds.Max = fixed.Point26_6{X: f.px(ext.XBearing + ext.Width), Y: -f.px(ext.YBearing + ext.Height)}
+	}
+	return bounds, f.px(f.face.HorizontalAdvance(gid)), true
+}
+
+func (f *bitmapFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	gid, ok := f.face.NominalGlyph(r)
+	if !ok {
+		return 0, false
+	}
+	return f.px(f.face.HorizontalAdvance(gid)), true
+}
+
+func (f *bitmapFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+func (f *bitmapFace) Metrics() font.Metrics {
+	ext, _ := f.face.FontHExtents()
+	return font.Metrics{
+		Height:  f.px(ext.Ascender - ext.Descender + ext.LineGap),
+		Ascent:  f.px(ext.Ascender),
+		Descent: -f.px(ext.Descender),
+	}
+}
@@ -2,51 +2,86 @@ package lib
 
 import (
 	"bufio"
-	"embed"
+	"errors"
 	"fmt"
-	"github.com/golang/freetype"
-	"github.com/golang/freetype/truetype"
 	"github.com/xuri/excelize/v2"
 	"golang.org/x/image/draw"
 	"golang.org/x/image/font"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
 	"image"
 	"image/color"
 	"image/png"
+	"math"
 	"os"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
-const colAxis = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-const colAxisLen = 26
+// renderDPI 绘制使用的DPI
+const renderDPI = 144
 
-var fontTTs = map[string]*truetype.Font{}
+// SheetActive 选择工作簿视图中的活动工作表
+const SheetActive = "@active"
 
-func Init(fonts embed.FS) error {
-	var fontFiles = map[string]string{
-		"微软雅黑":      "msyh.ttf",
-		"微软雅黑_bold": "msyh_bold.ttf",
-		"宋体":        "simsun.ttf",
-		"宋体_bold":   "simsun_bold.ttf",
-		"黑体":        "simhei.ttf",
-	}
-	for s, fontFile := range fontFiles {
-		buf, err := fonts.ReadFile("fonts/" + fontFile)
-		if err != nil {
-			return err
+// DefaultSheetFileName 多工作表转换时默认的文件名模板
+const DefaultSheetFileName = "{base}_{index}_{sheet}.png"
+
+type Ex2Img struct {
+	// Sheet 要转换的工作表: 名称, 从0开始的序号或 SheetActive, 为空时取第一个工作表
+	Sheet string
+	// Range 要转换的区域 如 B3:H40, Sheet1!B3:H40 或名称, 为空时转换整个已使用区域
+	Range string
+	// AutoFit 按内容计算列宽行高, 默认使用工作簿中的列宽行高
+	AutoFit bool
+	// ShowHidden 显示隐藏的行列(包括折叠的分级显示), 用于调试
+	ShowHidden bool
+	// IncludeHidden 转换全部工作表时是否包含隐藏的工作表
+	IncludeHidden bool
+	// Fonts 绘制使用的字体 为nil时使用 DefaultFonts
+	Fonts *FontRegistry
+	// Locale 内置数字格式的区域 决定货币符号和日期格式, 如 zh-CN zh-TW ja-JP ko-KR en-US, 为空时使用 DefaultLocale
+	Locale     string
+	dWidth     int
+	dHeight    int
+	mergeMG    *MergeMG
+	vertAligns *vertAligns
+}
+
+// SheetResult 单个工作表的转换结果
+type SheetResult struct {
+	Index  int
+	Sheet  string
+	Output string
+	Err    error
+}
+
+// resolveSheet 根据 Sheet 选择器获取工作表名称
+func (d *Ex2Img) resolveSheet(file *excelize.File) (string, error) {
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return "", errors.New("workbook has no sheets")
+	}
+	switch d.Sheet {
+	case "":
+		return sheets[0], nil
+	case SheetActive:
+		idx := file.GetActiveSheetIndex()
+		if idx < 0 || idx >= len(sheets) {
+			return sheets[0], nil
 		}
-		ft, err := freetype.ParseFont(buf)
-		if err != nil {
-			return err
+		return sheets[idx], nil
+	}
+	for _, name := range sheets {
+		if strings.EqualFold(name, d.Sheet) {
+			return name, nil
 		}
-		fontTTs[s] = ft
 	}
-	return nil
-}
-
-type Ex2Img struct {
-	dWidth  int
-	dHeight int
-	mergeMG *MergeMG
+	if idx, err := strconv.Atoi(d.Sheet); err == nil && idx >= 0 && idx < len(sheets) {
+		return sheets[idx], nil
+	}
+	return "", fmt.Errorf("sheet %s does not exist, available sheets: %s", d.Sheet, strings.Join(sheets, ", "))
 }
 
 // DrawExcelToPngFile  转换excel存储PNG图片到磁盘
@@ -58,69 +93,175 @@ func (d *Ex2Img) DrawExcelToPngFile(file *excelize.File, outPngName string) erro
 	return d.save(outPngName, rgba)
 }
 
+// DrawAllSheetsToPngFile 转换全部工作表 每个工作表存储一张PNG图片
+// nameTpl 为文件名模板 支持 {base} {index} {sheet} 占位符, 为空时使用 DefaultSheetFileName
+// 单个工作表失败不会中断 结果按工作表顺序返回
+func (d *Ex2Img) DrawAllSheetsToPngFile(file *excelize.File, base, nameTpl string) []SheetResult {
+	if nameTpl == "" {
+		nameTpl = DefaultSheetFileName
+	}
+	results := make([]SheetResult, 0)
+	for i, sheet := range file.GetSheetList() {
+		if !d.IncludeHidden && !file.GetSheetVisible(sheet) {
+			continue
+		}
+		output := strings.NewReplacer(
+			"{base}", base,
+			"{index}", strconv.Itoa(i),
+			"{sheet}", sheet,
+		).Replace(nameTpl)
+		result := SheetResult{Index: i, Sheet: sheet, Output: output}
+		rg, err := d.sheetRange(file, sheet)
+		if err == nil {
+			// 区域中的工作表前缀只在转换单个工作表时有效
+			rg.Sheet = sheet
+			var rgba *image.RGBA
+			if rgba, err = d.drawGrid(file, rg.Grid()); err == nil {
+				err = d.save(output, rgba)
+			}
+		}
+		result.Err = err
+		results = append(results, result)
+	}
+	return results
+}
+
 // DrawExcel 转换excel返回image.RGBA 可以按需要转成各种图片
 func (d *Ex2Img) DrawExcel(file *excelize.File) (rgba *image.RGBA, err error) {
+	sheet, err := d.resolveSheet(file)
+	if err != nil {
+		return
+	}
+	rg, err := d.sheetRange(file, sheet)
+	if err != nil {
+		return
+	}
+	return d.drawGrid(file, rg.Grid())
+}
+
+// sheetRange 获取要转换的区域 未设置 Range 时为整个已使用区域
+func (d *Ex2Img) sheetRange(file *excelize.File, sheet string) (*CellRange, error) {
+	if d.Range == "" {
+		return usedRange(file, sheet), nil
+	}
+	return d.resolveRange(file, sheet)
+}
+
+// getFonts 绘制使用的字体
+func (d *Ex2Img) getFonts() *FontRegistry {
+	if d.Fonts != nil {
+		return d.Fonts
+	}
+	return DefaultFonts
+}
+
+func (d *Ex2Img) drawGrid(file *excelize.File, g *Grid) (rgba *image.RGBA, err error) {
+	d.dWidth, d.dHeight = 0, 0
+	// 工作簿可能在两次转换之间被修改 重新读取上下标
+	d.vertAligns = nil
+	if len(d.getFonts().Families()) == 0 {
+		return nil, errors.New("no fonts loaded, call Init or set Ex2Img.Fonts")
+	}
+	dims, err := newSheetDims(file, g.Sheet)
+	if err != nil {
+		return
+	}
+	// 隐藏的行列不占空间
+	if !d.ShowHidden {
+		g = dims.visible(g)
+	}
+	if len(g.Rows) == 0 || len(g.Cols) == 0 {
+		return nil, fmt.Errorf("sheet %s has no data", g.Sheet)
+	}
 	// 获取合并单元格
-	sheet := file.GetSheetName(0)
-	mergeCells, err := file.GetMergeCells(sheet)
+	mergeCells, err := file.GetMergeCells(g.Sheet)
 	if err != nil {
 		return
 	}
-	d.mergeMG = NewMergeMG(mergeCells)
+	d.mergeMG = NewMergeMG(mergeCells, g)
 	// 解析数据
-	rows, xLen, err := d.parseRows(file)
+	rows, xLen, err := d.parseRows(file, g)
+	if err != nil {
+		return
+	}
 
-	var (
-		wMap = make(map[int]int)
-		hMap = make(map[int]int)
-	)
+	var widths, heights []int
+	if d.AutoFit {
+		widths, heights = d.fitSize(rows, xLen)
+	} else {
+		widths, heights = d.sheetSize(dims, g, rows)
+	}
+	lay := newGridLayout(widths, heights)
+	d.dWidth, d.dHeight = lay.width(), lay.height()
+	return d.draw(rows, lay), nil
+}
+
+// fitSize 按内容计算列宽行高 合并单元格内容放不下时增大其最后一行或列
+func (d *Ex2Img) fitSize(rows [][]*ICell, xLen int) (widths, heights []int) {
+	widths = make([]int, xLen)
+	heights = make([]int, len(rows))
 	// parse item width height
-	for i := 0; i < xLen; i++ {
-		if _, ok := wMap[i]; !ok {
-			wMap[i] = 0
-		}
-		for j, row := range rows {
-			if _, ok := hMap[j]; !ok {
-				hMap[j] = 0
+	for j, row := range rows {
+		for i, cell := range row {
+			if cell.Hide {
+				continue
 			}
-			if len(row) > i {
-				cell := row[i]
-				x, y := cell.getWh()
-				if cell.MrMain {
-					if cell.MrTypeX {
-						if y > hMap[j] {
-							hMap[j] = y
-						}
-					} else {
-						if x > wMap[i] {
-							wMap[i] = x
-						}
-					}
-					continue
-				}
-				if x > wMap[i] {
-					wMap[i] = x
-				}
-				if y > hMap[j] {
-					hMap[j] = y
-				}
+			x, y := cell.getWh()
+			if cell.Merge == nil || cell.Merge.Cols == 1 {
+				widths[i] = maxInt(widths[i], x)
+			}
+			if cell.Merge == nil || cell.Merge.Rows == 1 {
+				heights[j] = maxInt(heights[j], y)
 			}
 		}
 	}
-	for i, row := range rows {
-		for j := range row {
-			rows[i][j].Width = wMap[j]
-			rows[i][j].Height = hMap[i]
+	for _, m := range d.mergeMG.Merges {
+		x, y := rows[m.Row][m.Col].getWh()
+		w, h := 0, 0
+		for i := m.Col; i < m.Col+m.Cols; i++ {
+			w += widths[i]
+		}
+		for j := m.Row; j < m.Row+m.Rows; j++ {
+			h += heights[j]
+		}
+		if x > w {
+			widths[m.Col+m.Cols-1] += x - w
+		}
+		if y > h {
+			heights[m.Row+m.Rows-1] += y - h
 		}
 	}
-	// set dWidth, dHeight
-	for _, w := range wMap {
-		d.dWidth += w
-	}
-	for _, h := range hMap {
-		d.dHeight += h
+	return
+}
+
+// sheetSize 使用工作簿中的列宽行高 未设置行高的行随字号和文本行数增高(跨行的合并单元格不参与)
+func (d *Ex2Img) sheetSize(dims *sheetDims, g *Grid, rows [][]*ICell) (widths, heights []int) {
+	widths = make([]int, len(g.Cols))
+	heights = make([]int, len(g.Rows))
+	for i, col := range g.Cols {
+		widths[i] = dims.colWidth(col)
+	}
+	for j, r := range g.Rows {
+		h, fixed := dims.rowHeight(r)
+		if !fixed {
+			for _, cell := range rows[j] {
+				if cell.Value == "" || cell.Hide || (cell.Merge != nil && cell.Merge.Rows > 1) {
+					continue
+				}
+				// 自动换行按单元格宽度折行
+				cell.Width = widths[cell.Col]
+				if cell.Merge != nil {
+					cell.Width = 0
+					for i := cell.Col; i < cell.Col+cell.Merge.Cols; i++ {
+						cell.Width += widths[i]
+					}
+				}
+				h = maxInt(h, cell.getAutoHeight())
+			}
+		}
+		heights[j] = h
 	}
-	return d.draw(rows), nil
+	return
 }
 
 func (d *Ex2Img) GetStyle(file *excelize.File, styleID int) *Style {
@@ -159,6 +300,7 @@ func (d *Ex2Img) GetStyle(file *excelize.File, styleID int) *Style {
 			TextRotation: agt.TextRotation,
 			Vertical:     agt.Vertical,
 			WrapText:     agt.WrapText,
+			ReadingOrder: agt.ReadingOrder,
 		}
 	}
 
@@ -236,274 +378,461 @@ func (d *Ex2Img) GetStyle(file *excelize.File, styleID int) *Style {
 		style.Font.Italic = *v
 	}
 	if ft.U != nil {
-		style.Font.Underline = true
+		// 没有 val 属性时为单下划线
+		style.Font.Underline = "single"
+		if v := ft.U.Val; v != nil {
+			style.Font.Underline = underlineStyle(*v)
+		}
 	}
 	if ft.Strike != nil {
 		v := ft.Strike.Val
 		style.Font.Strike = *v
 	}
+	style.Font.VertAlign = d.fontVertAlign(file, *cs.FontID)
 	return style
 }
 
+// underlineStyle 下划线样式 none 时为空
+func underlineStyle(val string) string {
+	if val == "none" {
+		return ""
+	}
+	return val
+}
+
+// FormatNum 按样式的数字格式格式化数字 val, 自定义格式和内置格式使用同一个格式化器
 func (d *Ex2Img) FormatNum(file *excelize.File, styleID int, val string) (string, error) {
+	nt, err := d.formatCell(file, styleID, val)
+	return nt.text, err
+}
+
+// formatCell 按样式的数字格式格式化数字 val 并保留格式中 * 填充字符的位置
+func (d *Ex2Img) formatCell(file *excelize.File, styleID int, val string) (numberText, error) {
 	cs := file.Styles.CellXfs.Xf[styleID]
-	if cs.NumFmtID == nil {
-		return val, nil
-	}
-	numFmtID := *cs.NumFmtID
-	if file.Styles.NumFmts != nil {
-		for _, numFmt := range file.Styles.NumFmts.NumFmt {
-			if numFmt.NumFmtID == numFmtID {
-				pNumFt := parseFullNumberFormatString(numFmt.FormatCode)
-				return pNumFt.formatNumericCell(val)
-			}
-		}
+	// 未设置数字格式时为常规格式
+	numFmtID := 0
+	if cs.NumFmtID != nil {
+		numFmtID = *cs.NumFmtID
 	}
-	return val, nil
+	code, ok := d.numFmtCode(file, numFmtID)
+	if !ok {
+		return numberText{text: val}, nil
+	}
+	date1904 := file.WorkBook != nil && file.WorkBook.WorkbookPr != nil && file.WorkBook.WorkbookPr.Date1904
+	return parseFullNumberFormatString(code).format(val, date1904)
 }
 
-func (d *Ex2Img) parseRows(file *excelize.File) (rows [][]*ICell, xLen int, err error) {
-	sheet1 := file.GetSheetList()[0]
-	rows = make([][]*ICell, 0)
-	xLen = 0
-	//opts := excelize.Options{
-	//	RawCellValue:      true,
-	//}
-	data, err := file.GetRows(sheet1)
-	if err != nil {
-		return
+// formatText 按样式数字格式的文本节格式化文本单元格的值 val
+func (d *Ex2Img) formatText(file *excelize.File, styleID int, val string) numberText {
+	cs := file.Styles.CellXfs.Xf[styleID]
+	if cs.NumFmtID == nil {
+		return numberText{text: val}
 	}
-	for i, datum := range data {
-		row := make([]*ICell, 0)
-		iLen := 0
-		for j := range datum {
-			preFix := ""
-			if j/colAxisLen >= 1 {
-				preFix = string(colAxis[j/colAxisLen-1])
-			}
-			axis := fmt.Sprintf("%s%s%d", preFix, string(colAxis[j%colAxisLen]), i+1)
-			val, _ := file.GetCellValue(sheet1, axis)
-			styleID, err := file.GetCellStyle(sheet1, axis)
+	code, ok := d.numFmtCode(file, *cs.NumFmtID)
+	if !ok {
+		return numberText{text: val}
+	}
+	return parseFullNumberFormatString(code).formatText(val)
+}
+
+func (d *Ex2Img) parseRows(file *excelize.File, g *Grid) (rows [][]*ICell, xLen int, err error) {
+	rows = make([][]*ICell, 0, len(g.Rows))
+	xLen = len(g.Cols)
+	for j, r := range g.Rows {
+		row := make([]*ICell, 0, xLen)
+		for i, c := range g.Cols {
+			axis, err := excelize.CoordinatesToCellName(c, r)
 			if err != nil {
-				fmt.Printf("file.GetCellStyle(%s, %s)  err %v\n", sheet1, axis, err)
-				continue
+				return nil, 0, err
 			}
-			if IsNum(val) {
-				cType, err := file.GetCellType(sheet1, axis)
-				if err == nil {
-					if cType == excelize.CellTypeString && strings.HasSuffix(val, ".00") {
-						val = strings.TrimSuffix(val, ".00")
-					}
+			iCell := &ICell{Axis: axis, Row: j, Col: i, fonts: d.getFonts()}
+			origin := axis
+			// 判断是合并单元格 被截断的合并单元格值和样式取自原合并单元格
+			if mgr := d.mergeMG.Get(j, i); mgr != nil {
+				iCell.Merge = mgr
+				if mgr.IsMain(j, i) {
+					iCell.MrMain = true
+					origin = mgr.Origin
+				} else {
+					iCell.Hide = true
 				}
-				val, _ = d.FormatNum(file, styleID, val)
 			}
-			iCell := &ICell{
-				Axis:  axis,
-				Value: val,
-				Style: d.GetStyle(file, styleID),
+			var nt numberText
+			nt, iCell.Type, iCell.Style = d.readCell(file, g.Sheet, origin)
+			iCell.Value, iCell.fill, iCell.fillAt = nt.text, nt.fill, nt.fillAt
+			if nt.general {
+				iCell.general = &nt.value
 			}
-			// 判断是被合并单元格
-			if mgr, ok := d.mergeMG.HideCells[iCell.Axis]; ok {
-				iCell.Hide = true
+			if iCell.Hide {
 				iCell.Value = ""
-				mgr.MrCells = append(mgr.MrCells, iCell)
-			}
-			// 判断是被合并单元格@Y
-			if mgr, ok := d.mergeMG.HideCellsY[iCell.Axis]; ok {
-				iCell.Hide = true
-				iCell.Value = ""
-				mgr.MrCellsY = append(mgr.MrCellsY, iCell)
-			}
-			if v, ok := d.mergeMG.MainCells[iCell.Axis]; ok {
-				iCell.MrMain = true
-				iCell.MrTypeX = v.TypeX
+			} else if iCell.Type == excelize.CellTypeString {
+				iCell.Runs = d.readRuns(file, g.Sheet, origin, iCell.Value, iCell.Style.Font)
 			}
 			row = append(row, iCell)
-			iLen += 1
 		}
 		rows = append(rows, row)
-		if iLen > xLen {
-			xLen = iLen
-		}
 	}
-	// 补齐无数据单元格
-	for i, row := range rows {
-		if len(row) < xLen {
-			for j := len(row); j < xLen; j++ {
-				preFix := ""
-				if j/colAxisLen >= 1 {
-					preFix = string(colAxis[j/colAxisLen-1])
-				}
-				axis := fmt.Sprintf("%s%s%d", preFix, string(colAxis[j%colAxisLen]), i+1)
-				iCell := &ICell{
-					Axis:  axis,
-					Value: "",
-					Style: &Style{},
-				}
-				styleID, err := file.GetCellStyle(sheet1, axis)
-				if err == nil {
-					iCell.Style = d.GetStyle(file, styleID)
-				}
-				// 判断是被合并单元格
-				if mgr, ok := d.mergeMG.HideCells[iCell.Axis]; ok {
-					iCell.Hide = true
-					mgr.MrCells = append(mgr.MrCells, iCell)
-				}
-				// 判断是被合并单元格@Y
-				if mgr, ok := d.mergeMG.HideCellsY[iCell.Axis]; ok {
-					iCell.Hide = true
-					mgr.MrCellsY = append(mgr.MrCellsY, iCell)
-				}
-				rows[i] = append(rows[i], iCell)
-			}
+	return
+}
+
+// readCell 读取单元格格式化后的值, 类型和样式
+func (d *Ex2Img) readCell(file *excelize.File, sheet, axis string) (numberText, excelize.CellType, *Style) {
+	styleID, err := file.GetCellStyle(sheet, axis)
+	if err != nil {
+		fmt.Printf("file.GetCellStyle(%s, %s)  err %v\n", sheet, axis, err)
+		return numberText{}, excelize.CellTypeUnset, &Style{}
+	}
+	val, _ := file.GetCellValue(sheet, axis)
+	cType, _ := file.GetCellType(sheet, axis)
+	// 数字取原始值按样式的格式代码格式化 不支持的格式保留 excelize 格式化的值
+	// excelize 也会格式化看起来像数字的文本 文本单元格取原始值, 只按格式的文本节格式化
+	num, _ := file.GetCellValue(sheet, axis, excelize.Options{RawCellValue: true})
+	if cType == excelize.CellTypeString {
+		return d.formatText(file, styleID, num), cType, d.GetStyle(file, styleID)
+	}
+	if IsNum(num) {
+		if nt, err := d.formatCell(file, styleID, num); err == nil {
+			return nt, cType, d.GetStyle(file, styleID)
 		}
 	}
-	return
+	return numberText{text: val}, cType, d.GetStyle(file, styleID)
 }
 
-func (d *Ex2Img) doMarge(cell *ICell) {
-	// 判断是被合并单元格 执行合并
-	if mgr, ok := d.mergeMG.MainCells[cell.Axis]; ok {
-		switch mgr.TypeX {
-		case true:
-			w := cell.Width
-			for _, mrCell := range mgr.MrCells {
-				w += mrCell.Width
+// readRuns 读取富文本的每一段 未设置的字体属性取单元格字体, 不是富文本时返回nil
+func (d *Ex2Img) readRuns(file *excelize.File, sheet, axis, val string, cellFont Font) []*IRun {
+	richRuns, err := file.GetCellRichText(sheet, axis)
+	if err != nil || len(richRuns) == 0 {
+		return nil
+	}
+	runs := make([]*IRun, 0, len(richRuns))
+	text := ""
+	aligns := d.runVertAligns(file, sheet, axis)
+	for i, rr := range richRuns {
+		run := &IRun{Text: rr.Text, Font: cellFont}
+		if ft := rr.Font; ft != nil {
+			run.Font.Bold = ft.Bold
+			run.Font.Italic = ft.Italic
+			run.Font.Strike = ft.Strike
+			run.Font.Underline = underlineStyle(ft.Underline)
+			run.Font.VertAlign = ""
+			if i < len(aligns) {
+				run.Font.VertAlign = aligns[i]
 			}
-			cell.Width = w
-			if len(mgr.MrCellsY) > 0 {
-				hRow := map[string]int{}
-				for _, iCell := range mgr.MrCellsY {
-					hRow[iCell.Axis[1:]] = iCell.Height
-				}
-				for _, i := range hRow {
-					cell.Height += i
-				}
+			if ft.Family != "" {
+				run.Font.Name = ft.Family
+			}
+			if ft.Size > 0 {
+				run.Font.Size = ft.Size
 			}
-		case false:
-			h := cell.Height
-			for _, mrCell := range mgr.MrCells {
-				h += mrCell.Height
+			if ft.Color != "" {
+				run.Font.Color = ft.Color
 			}
-			cell.Height = h
 		}
-		cell.MrMain = true
+		runs = append(runs, run)
+		text += rr.Text
+	}
+	// 共享字符串的序号取自单元格的值 非共享字符串的单元格可能取到其他的字符串
+	if text != val {
+		return nil
 	}
+	return runs
 }
 
-func (d *Ex2Img) draw(rows [][]*ICell) *image.RGBA {
+func (d *Ex2Img) draw(rows [][]*ICell, lay *gridLayout) *image.RGBA {
 	bg := image.White
-	rgba := image.NewRGBA(image.Rect(0, 0, d.dWidth, d.dHeight))
+	// 右侧和底部多留1像素绘制最后的边框
+	rgba := image.NewRGBA(image.Rect(0, 0, d.dWidth+1, d.dHeight+1))
 	draw.Draw(rgba, rgba.Bounds(), bg, image.Point{}, draw.Src)
-	var startY = 0
+	// 合并单元格只绘制一次 占满整个合并区域
 	for _, row := range rows {
-		startY = d.drawRow(rgba, row, startY)
-	}
-	dst := image.NewRGBA(image.Rect(0, 0, d.dWidth, d.dHeight))
-	draw.Draw(dst, image.Rect(0, 0, d.dWidth, d.dHeight), rgba, image.Point{1, 2}, draw.Src)
-	return dst
-}
-
-func (d *Ex2Img) drawCell(cell *ICell) (*image.RGBA, int) {
-	// 执行合并单元格
-	d.doMarge(cell)
-	fg, bg := cell.getFontColor(), cell.getBgColor()
-	rgba := image.NewRGBA(image.Rect(0, 0, cell.Width*2, cell.Height))
-	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
-	c := freetype.NewContext()
-	c.SetDPI(144)
-	c.SetFont(cell.getFontTT())
-	c.SetFontSize(float64(cell.getSize()))
-	c.SetClip(rgba.Bounds())
-	c.SetDst(rgba)
-	c.SetSrc(image.NewUniform(fg))
-	c.SetHinting(font.HintingFull)
-	x, y := cell.Width, cell.getBeginPY()
-	// draw
-	pt := freetype.Pt(x, y)
-	nPoint, err := c.DrawString(cell.Value, pt)
-	if err != nil {
-		return rgba, 0
+		for _, cell := range row {
+			if cell.Hide {
+				continue
+			}
+			draw.Draw(rgba, lay.cellRect(cell), image.NewUniform(cell.getBgColor()), image.Point{}, draw.Src)
+		}
 	}
-	// 实际宽
-	trueWidth := nPoint.X.Ceil() - x
-	// 下滑线
-	if cell.Style.Font.Underline {
-		ly := y + 1
-		lx := x + trueWidth
-		d.drawLine(rgba, x, ly, lx, ly, color.Black)
+	// 文本在背景之后绘制 可以延伸到相邻的单元格
+	for _, row := range rows {
+		for _, cell := range row {
+			if cell.Hide || cell.Value == "" {
+				continue
+			}
+			rect, clip := d.textRect(rows, lay, cell)
+			cell.Width, cell.Height = rect.Dx(), rect.Dy()
+			draw.Draw(rgba, clip, d.drawCell(cell), clip.Min.Sub(rect.Min), draw.Over)
+		}
 	}
-	// 删除线
-	if cell.Style.Font.Strike {
-		ly := y - cell.getSize()/2
-		lx := x + trueWidth
-		d.drawLine(rgba, x, ly, lx, ly, color.Black)
-	}
-	// 更好的横对齐
-	sx := cell.Width
-	switch cell.Style.Alignment.Horizontal {
-	case "center":
-		sx = x - (cell.Width/2 - trueWidth/2)
-	case "left":
-		sx = sx - 2
-	case "right":
-		sx = x - (cell.Width - trueWidth)
+	// 边框画在单元格之间的网格线上 避免相邻单元格的边框重复
+	for _, row := range rows {
+		for _, cell := range row {
+			d.drawBorder(rgba, cell, lay.trackRect(cell.Row, cell.Col))
+		}
 	}
-	// 画边框
-	if cell.Style.Border.Left != "" {
-		ruler := cell.getBorderLeftColor()
-		d.drawLine(rgba, sx+1, 1, sx+1, cell.Height, ruler)
+	return rgba
+}
+
+// textRect 文本排版的区域 rect 和实际绘制的裁剪区域 clip
+// 跨列居中时延伸到右侧同样跨列居中的空单元格
+// 放不下的文本溢出到相邻的空单元格: 左对齐向右, 右对齐向左, 居中向两侧, 遇到非空或合并单元格时截断
+func (d *Ex2Img) textRect(rows [][]*ICell, lay *gridLayout, cell *ICell) (rect, clip image.Rectangle) {
+	rect = lay.cellRect(cell)
+	if cell.Merge != nil {
+		return rect, rect
+	}
+	row := rows[cell.Row]
+	isEmpty := func(i int) bool {
+		return i >= 0 && i < len(row) && row[i].Value == "" && row[i].Merge == nil
+	}
+	if cell.getHorizontal() == "centerContinuous" {
+		for i := cell.Col + 1; isEmpty(i) && row[i].Style.Alignment.Horizontal == "centerContinuous"; i++ {
+			rect.Max.X = lay.colX[i+1]
+		}
+		return rect, rect
 	}
-	if cell.Style.Border.Top != "" {
-		ruler := cell.getBorderTopColor()
-		d.drawLine(rgba, sx+1, 1, sx+cell.Width, 1, ruler)
+	cell.Width, cell.Height = rect.Dx(), rect.Dy()
+	if !cell.canOverflow() {
+		return rect, rect
 	}
-	if cell.Style.Border.Right != "" {
-		ruler := cell.getBorderRightColor()
-		d.drawLine(rgba, sx+cell.Width-1, 1, sx+cell.Width-1, cell.Height, ruler)
+	over := cell.getValWidth() - cell.getTextWidth()
+	if over <= 0 {
+		return rect, rect
+	}
+	// 向左右溢出的宽度
+	left, right := 0, 0
+	switch cell.getHorizontal() {
+	case "right":
+		left = over
+	case "center":
+		left = over / 2
+		right = over - left
+	default:
+		right = over
 	}
-	if cell.Style.Border.Bottom != "" {
-		ruler := cell.getBorderBottomColor()
-		d.drawLine(rgba, sx+1, cell.Height-1, sx+cell.Width, cell.Height-1, ruler)
+	clip = rect
+	for i := cell.Col + 1; right > 0 && clip.Max.X < rect.Max.X+right && isEmpty(i); i++ {
+		clip.Max.X = lay.colX[i+1]
 	}
-	return rgba, sx
+	for i := cell.Col - 1; left > 0 && clip.Min.X > rect.Min.X-left && isEmpty(i); i-- {
+		clip.Min.X = lay.colX[i]
+	}
+	rect.Min.X -= left
+	rect.Max.X += right
+	return rect, clip.Intersect(rect)
 }
 
-func (d *Ex2Img) drawLine(dst *image.RGBA, x, y, x2, y2 int, ruler color.Color) {
-	for i := x; i <= x2; i++ {
-		dst.Set(i, y, ruler)
+// drawCell 绘制单元格的文本 背景透明
+func (d *Ex2Img) drawCell(cell *ICell) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, cell.Width, cell.Height))
+	cell.shrinkToFit()
+	cell.fitNumber()
+	cell.fillNumber()
+	if cell.getRotation() != 0 {
+		d.drawRotated(rgba, cell)
+		return rgba
+	}
+	lines, ends := cell.layoutLines()
+	ys := cell.getBaselines(lines)
+	// 竖排时字符在最宽的字符内居中
+	blockW, _ := cell.getTextSize()
+	horizontal := cell.getHorizontal()
+	for i, line := range lines {
+		// 实际宽
+		trueWidth := cell.getLineWidth(line)
+		x, y := cell.getBeginPX(trueWidth), ys[i]
+		switch {
+		case cell.isStacked():
+			x = cell.getBeginPX(blockW) + (blockW-trueWidth)/2
+		case cell.shapeLine(line) != nil:
+			// 塑形的复杂文字不增加字间距
+		case horizontal == "distributed" && utf8.RuneCountInString(line.String()) > 1:
+			d.drawSpaced(rgba, cell, line, cellPadding+cell.getIndent(), y, cell.getTextWidth(), true)
+			continue
+		case horizontal == "justify" && !ends[i]:
+			d.drawSpaced(rgba, cell, line, x, y, cell.getTextWidth(), false)
+			continue
+		}
+		d.drawTextLine(rgba, cell, line, x, y)
 	}
-	for i := y; i <= y2; i++ {
-		dst.Set(x, i, ruler)
+	return rgba
+}
+
+// drawSpaced 两端对齐或分散对齐绘制一行文本 多余的宽度平均分配到单词或字符之间, 使文本占满宽度 width
+func (d *Ex2Img) drawSpaced(dst *image.RGBA, cell *ICell, line textLine, x, y, width int, byChar bool) {
+	text := strings.TrimRight(line.String(), " ")
+	pieces := spacedPieces(text, byChar)
+	extra := width - cell.getLineWidth(sliceRuns(line, 0, len(text)))
+	if len(pieces) < 2 || extra <= 0 {
+		d.drawTextLine(dst, cell, line, x, y)
+		return
+	}
+	gaps := len(pieces) - 1
+	for i, rg := range pieces {
+		piece := sliceRuns(line, rg[0], rg[1])
+		d.drawTextLine(dst, cell, piece, x, y)
+		x += cell.getLineWidth(piece) + extra/gaps
+		if i < extra%gaps {
+			x++
+		}
 	}
 }
 
-func (d *Ex2Img) drawRow(dst *image.RGBA, row []*ICell, startY int) (nextStartY int) {
-	x, y, offsetY := 0, startY+1, 0
-	cellY := row[0].Height
-	for _, cell := range row {
-		if cell.Hide {
-			if mgr, ok := d.mergeMG.HideCells[cell.Axis]; ok {
-				if !mgr.TypeX {
-					x += cell.Width
-				}
+// drawRotated 绘制旋转的文字 先绘制未旋转的文本块 再旋转到单元格中
+func (d *Ex2Img) drawRotated(dst *image.RGBA, cell *ICell) {
+	tw, th := cell.getTextSize()
+	text := image.NewRGBA(image.Rect(0, 0, tw, th))
+	lines := cell.getLines()
+	ys, _ := cell.getLineOffsets(lines)
+	for i, line := range lines {
+		x := 0
+		w := cell.getLineWidth(line)
+		switch cell.getHorizontal() {
+		case "center", "centerContinuous", "distributed":
+			x = (tw - w) / 2
+		case "right":
+			x = tw - w
+		}
+		d.drawTextLine(text, cell, line, x, ys[i])
+	}
+	// 逆时针旋转 图像坐标系y轴向下
+	rad := float64(cell.getRotation()) * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	minX, minY := math.Min(0, float64(tw)*cos), math.Min(0, -float64(tw)*sin)
+	minX = math.Min(minX, minX+float64(th)*sin)
+	minY = math.Min(minY, minY+float64(th)*cos)
+	bw, bh := cell.getRotatedSize()
+	ox, oy := float64(cell.getBeginPX(bw)), float64(cell.getBlockPY(bh))
+	s2d := f64.Aff3{
+		cos, sin, ox - minX,
+		-sin, cos, oy - minY,
+	}
+	draw.BiLinear.Transform(dst, s2d, text, text.Bounds(), draw.Over, nil)
+}
+
+// drawTextLine 在基线 (x, y) 处绘制一行文本 每一段使用各自的字体, 颜色, 下划线和删除线
+func (d *Ex2Img) drawTextLine(dst *image.RGBA, cell *ICell, line textLine, x, y int) {
+	if sl := cell.shapeLine(line); sl != nil {
+		d.drawShapedLine(dst, cell, sl, x, y)
+		return
+	}
+	for _, r := range line {
+		face := cell.getRunFace(r.Font)
+		// 上标和下标偏移基线
+		ry := y - cell.getBaselineShift(r.Font)
+		if cell.hasColorGlyphs(r) {
+			d.drawColorString(dst, cell, r, x, ry)
+		} else {
+			dr := &font.Drawer{
+				Dst:  dst,
+				Src:  image.NewUniform(cell.getRunColor(r.Font)),
+				Face: face,
+				Dot:  fixed.P(x, ry),
 			}
-			if _, ok := d.mergeMG.HideCellsY[cell.Axis]; ok {
-				x += cell.Width
+			dr.DrawString(r.Text)
+		}
+		w := measureText(face, r.Text)
+		d.drawDecoration(dst, cell, r.Font, x, ry, w)
+		x += w
+	}
+}
+
+// drawColorString 在基线 (x, y) 处绘制含彩色字形的一段文本 与 font.Drawer 相同逐字绘制, 彩色字形按原有颜色绘制
+func (d *Ex2Img) drawColorString(dst *image.RGBA, cell *ICell, r *IRun, x, y int) {
+	face := cell.getRunFace(r.Font).(*fallbackFace)
+	fg := cell.getRunColor(r.Font)
+	size := fixed.Int26_6(math.Round(cell.getRunSize(r.Font) * renderDPI / 72 * 64))
+	dot := fixed.P(x, y)
+	prev := rune(-1)
+	for _, ch := range r.Text {
+		if prev >= 0 {
+			dot.X += face.Kern(prev, ch)
+		}
+		gf := face.glyphFor(ch)
+		if sf := cell.shapingFace(gf.ft); sf == nil || !cell.drawColorGlyph(dst, gf.ft, sf, nominalGlyph(sf, ch), size, dot, fg) {
+			if dr, mask, maskp, _, ok := face.Glyph(dot, ch); ok {
+				draw.DrawMask(dst, dr, image.NewUniform(fg), image.Point{}, mask, maskp, draw.Over)
 			}
-			continue
 		}
-		ira, sx := d.drawCell(cell)
-		if !cell.MrMain {
-			offsetY = cell.Height
+		adv, _ := face.GlyphAdvance(ch)
+		dot.X += adv
+		prev = ch
+	}
+}
+
+// drawShapedLine 在基线 (x, y) 处绘制塑形后的一行文本
+func (d *Ex2Img) drawShapedLine(dst *image.RGBA, cell *ICell, sl *shapedLine, x, y int) {
+	dot := fixed.I(x)
+	for i := range sl.runs {
+		run := &sl.runs[i]
+		start := dot
+		fg := cell.getRunColor(run.font)
+		ry := y - cell.getBaselineShift(run.font)
+		for _, g := range run.out.Glyphs {
+			cell.drawGlyph(dst, fg, run, g, dot+g.XOffset, fixed.I(ry)-g.YOffset)
+			dot += g.XAdvance
 		}
-		draw.Draw(dst, image.Rect(x, y, cell.Width+x, cell.Height+y), ira, image.Point{sx, 0}, draw.Src)
-		x += cell.Width
+		d.drawDecoration(dst, cell, run.font, start.Round(), ry, (dot - start).Round())
+	}
+}
+
+// drawDecoration 用文字颜色绘制基线 (x, y) 处宽度为 w 的下划线和删除线
+// 会计用下划线比普通下划线低, 并占满整个单元格的宽度
+func (d *Ex2Img) drawDecoration(dst *image.RGBA, cell *ICell, f Font, x, y, w int) {
+	fg := cell.getRunColor(f)
+	px := cell.getRunSize(f) * renderDPI / 72
+	// 线宽随字号变粗
+	thick := maxInt(1, int(math.Round(px/16)))
+	offset := maxInt(1, int(px/12))
+	ux, uw := x, w
+	if f.Underline == "singleAccounting" || f.Underline == "doubleAccounting" {
+		descent := cell.getRunFace(f).Metrics().Descent.Ceil()
+		offset = maxInt(offset+2*thick, descent/2)
+		b := dst.Bounds()
+		ux, uw = b.Min.X+cellPadding/2, b.Dx()-cellPadding
+	}
+	switch f.Underline {
+	case "single", "singleAccounting":
+		d.drawBar(dst, ux, y+offset, uw, thick, fg)
+	case "double", "doubleAccounting":
+		d.drawBar(dst, ux, y+offset, uw, thick, fg)
+		d.drawBar(dst, ux, y+offset+2*thick, uw, thick, fg)
+	}
+	// 删除线
+	if f.Strike {
+		d.drawBar(dst, x, y-int(cell.getRunSize(f))/2, w, thick, fg)
+	}
+}
+
+// drawBar 绘制左上角为 (x, y) 宽 w 高 h 的横线
+func (d *Ex2Img) drawBar(dst *image.RGBA, x, y, w, h int, c color.Color) {
+	draw.Draw(dst, image.Rect(x, y, x+w+1, y+h), image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// drawBorder 绘制单元格的边框 合并区域内部的边不绘制
+func (d *Ex2Img) drawBorder(dst *image.RGBA, cell *ICell, rect image.Rectangle) {
+	m := cell.Merge
+	x0, y0, x1, y1 := rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y
+	if cell.Style.Border.Left != "" && (m == nil || cell.Col == m.Col) {
+		d.drawLine(dst, x0, y0, x0, y1, cell.getBorderLeftColor())
 	}
-	if offsetY == 0 {
-		offsetY = cellY
+	if cell.Style.Border.Top != "" && (m == nil || cell.Row == m.Row) {
+		d.drawLine(dst, x0, y0, x1, y0, cell.getBorderTopColor())
+	}
+	if cell.Style.Border.Right != "" && (m == nil || cell.Col == m.Col+m.Cols-1) {
+		d.drawLine(dst, x1, y0, x1, y1, cell.getBorderRightColor())
+	}
+	if cell.Style.Border.Bottom != "" && (m == nil || cell.Row == m.Row+m.Rows-1) {
+		d.drawLine(dst, x0, y1, x1, y1, cell.getBorderBottomColor())
+	}
+}
+
+func (d *Ex2Img) drawLine(dst *image.RGBA, x, y, x2, y2 int, ruler color.Color) {
+	for i := x; i <= x2; i++ {
+		dst.Set(i, y, ruler)
+	}
+	for i := y; i <= y2; i++ {
+		dst.Set(x, i, ruler)
 	}
-	return startY + offsetY
 }
 
 func (d *Ex2Img) save(filename string, rgba *image.RGBA) error {
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"strings"
+	"testing"
+)
+
+func TestResolveSheet(t *testing.T) {
+	// 工作表 Sheet1, Data, 2019, 活动工作表为 Data
+	file := excelize.NewFile()
+	file.NewSheet("Data")
+	file.SetActiveSheet(file.NewSheet("2019") - 1)
+	tests := []struct {
+		name  string
+		sheet string
+		want  string
+		err   string
+	}{
+		{"first sheet by default", "", "Sheet1", ""},
+		{"active sheet", SheetActive, "Data", ""},
+		{"name", "Data", "Data", ""},
+		{"name ignores case", "DATA", "Data", ""},
+		{"index", "1", "Data", ""},
+		{"name before index", "2019", "2019", ""},
+		{"index out of range", "3", "", "sheet 3 does not exist, available sheets: Sheet1, Data, 2019"},
+		{"negative index", "-1", "", "sheet -1 does not exist"},
+		{"missing sheet", "Missing", "", "sheet Missing does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Ex2Img{Sheet: tt.sheet}).resolveSheet(file)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSheetActiveOutOfRange(t *testing.T) {
+	// 工作簿视图中的活动工作表序号无效时 取第一个工作表
+	file := openWorkbookParts(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<bookViews><workbookView activeTab="5"/></bookViews><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+	})
+	got, err := (&Ex2Img{Sheet: SheetActive}).resolveSheet(file)
+	if err != nil || got != "Sheet1" {
+		t.Errorf("got %q, %v, want Sheet1", got, err)
+	}
+}
@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"image"
+)
+
+// fallbackFace 逐个字符选择字体 首选字体缺少的字符使用后备字体中第一个包含该字符的字体
+// 表情字符优先使用包含它的彩色字体, 字符使用的字体由 FontRegistry 缓存, 这里只为用到的后备字体创建 font.Face
+type fallbackFace struct {
+	// faces 首选字体和已创建的后备字体
+	faces   []glyphFace
+	font    Font
+	fonts   *FontRegistry
+	newFace func(fb fallbackFont) font.Face
+	runes   map[rune]glyphFace
+	// emojiRunes 以彩色表情显示的字符使用的字体
+	emojiRunes map[rune]glyphFace
+}
+
+type glyphFace struct {
+	face font.Face
+	ft   *truetype.Font
+}
+
+func newFallbackFace(face font.Face, ft *truetype.Font, f Font, fonts *FontRegistry, newFace func(fb fallbackFont) font.Face) *fallbackFace {
+	return &fallbackFace{
+		faces:      []glyphFace{{face: face, ft: ft}},
+		font:       f,
+		fonts:      fonts,
+		newFace:    newFace,
+		runes:      map[rune]glyphFace{},
+		emojiRunes: map[rune]glyphFace{},
+	}
+}
+
+// faceFor 绘制字符 r 使用的字体 所有字体都没有该字符时使用首选字体
+func (f *fallbackFace) faceFor(r rune) font.Face {
+	return f.glyphFor(r).face
+}
+
+func (f *fallbackFace) glyphFor(r rune) glyphFace {
+	return f.glyphForPresentation(r, isEmoji(r))
+}
+
+// glyphForPresentation 字符 r 使用的字体 emoji 为true时优先使用彩色字体
+func (f *fallbackFace) glyphForPresentation(r rune, emoji bool) glyphFace {
+	cache := f.runes
+	if emoji {
+		cache = f.emojiRunes
+	}
+	if gf, ok := cache[r]; ok {
+		return gf
+	}
+	gf := f.faces[0]
+	if fb := f.fonts.glyphFont(f.font, f.faces[0].ft, r, emoji); fb.ft != nil {
+		gf = f.loaded(fb)
+	}
+	cache[r] = gf
+	return gf
+}
+
+// loaded 后备字体 fb 的 font.Face 第一次用到时创建
+func (f *fallbackFace) loaded(fb fallbackFont) glyphFace {
+	for _, gf := range f.faces {
+		if gf.ft == fb.ft {
+			return gf
+		}
+	}
+	gf := glyphFace{face: f.newFace(fb), ft: fb.ft}
+	f.faces = append(f.faces, gf)
+	return gf
+}
+
+// fallbackFont 后备字体 boldSyn italicSyn 标记需要模拟的粗体和斜体
+type fallbackFont struct {
+	ft        *truetype.Font
+	boldSyn   bool
+	italicSyn bool
+}
+
+// glyphKey 字符使用的字体的缓存键
+type glyphKey struct {
+	family string
+	bold   bool
+	italic bool
+	emoji  bool
+	r      rune
+}
+
+// glyphFont 字体 f 中字符 r 使用的后备字体 首选字体 primary 有该字符或所有字体都没有时 ft 为nil
+// 结果按字体族, 样式和字符缓存 与字号无关
+func (r *FontRegistry) glyphFont(f Font, primary *truetype.Font, ch rune, emoji bool) fallbackFont {
+	key := glyphKey{family: familyKey(f.Name), bold: f.Bold, italic: f.Italic, emoji: emoji, r: ch}
+	r.glyphMu.Lock()
+	fb, ok := r.glyphs[key]
+	r.glyphMu.Unlock()
+	if ok {
+		return fb
+	}
+	fb = r.findGlyphFont(f, primary, ch, emoji)
+	r.glyphMu.Lock()
+	if r.glyphs == nil {
+		r.glyphs = map[glyphKey]fallbackFont{}
+	}
+	r.glyphs[key] = fb
+	r.glyphMu.Unlock()
+	return fb
+}
+
+func (r *FontRegistry) findGlyphFont(f Font, primary *truetype.Font, ch rune, emoji bool) fallbackFont {
+	var found fallbackFont
+	if r.hasGlyph(primary, ch) {
+		if !emoji || r.isColorFont(primary) {
+			return found
+		}
+		found.ft = primary
+	}
+	tried := map[*truetype.Font]bool{primary: true}
+	for _, family := range r.fallbackChain(f.Name) {
+		ft, boldSyn, italicSyn := r.lookupFamily(family, f.Bold, f.Italic)
+		if ft == nil || tried[ft] {
+			continue
+		}
+		tried[ft] = true
+		if !r.hasGlyph(ft, ch) {
+			continue
+		}
+		fb := fallbackFont{ft: ft, boldSyn: boldSyn, italicSyn: italicSyn}
+		if !emoji || r.isColorFont(ft) {
+			found = fb
+			break
+		}
+		if found.ft == nil {
+			found = fb
+		}
+	}
+	// 首选字体有该字符 且后备字体中没有彩色字体时使用首选字体
+	if found.ft == primary {
+		return fallbackFont{}
+	}
+	return found
+}
+
+// resetGlyphs 注册的字体或后备顺序变化后清空字符使用的字体的缓存
+func (r *FontRegistry) resetGlyphs() {
+	r.glyphMu.Lock()
+	r.glyphs = nil
+	r.glyphMu.Unlock()
+}
+
+func (f *fallbackFace) Close() error {
+	return nil
+}
+
+// 变体选择符等不显示的字符没有字形和宽度
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	if isIgnorable(r) {
+		return dr, nil, maskp, 0, false
+	}
+	return f.faceFor(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	if isIgnorable(r) {
+		return bounds, 0, true
+	}
+	return f.faceFor(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	if isIgnorable(r) {
+		return 0, true
+	}
+	return f.faceFor(r).GlyphAdvance(r)
+}
+
+// Kern 不同字体的字符之间没有字偶距
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.faceFor(r0)
+	if face != f.faceFor(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+// Metrics 行高等度量使用首选字体
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].face.Metrics()
+}
@@ -0,0 +1,309 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/freetype/truetype"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// DefaultFallbackFamily 找不到单元格的字体时默认使用的字体
+const DefaultFallbackFamily = "微软雅黑"
+
+// DefaultFonts 默认的字体注册表 Init 加载的字体在这里, Ex2Img 未设置 Fonts 时使用
+var DefaultFonts = NewFontRegistry()
+
+// FontRegistry 字体注册表 按字体文件中的字体族名称(包括宋体/SimSun 这样的本地化名称)和粗体斜体样式索引
+// 可以被多个 Ex2Img 同时使用
+type FontRegistry struct {
+	mu       sync.RWMutex
+	families map[string]*fontFamily
+	// order 字体族的注册顺序
+	order    []*fontFamily
+	fallback string
+	// chains 字体族缺少字符时依次尝试的字体族 键为空字符串时是所有字体共用的顺序
+	chains map[string][]string
+	// substitutes 字体族未安装时依次尝试的替代字体族
+	substitutes map[string][]string
+	// sources 从文件加载的字体的数据 用于文字塑形
+	sources map[*truetype.Font]*fontSource
+	// glyphs 字符使用的后备字体 见 glyphFont
+	glyphMu sync.Mutex
+	glyphs  map[glyphKey]fallbackFont
+}
+
+type fontFamily struct {
+	name string
+	// faces 按 fontStyleIndex 存放常规, 粗体, 斜体, 粗斜体
+	faces [4]*registeredFont
+}
+
+type registeredFont struct {
+	ft *truetype.Font
+	// priority 同一名称和样式有多个字体时保留优先级高的
+	priority int
+}
+
+// 字体名称的优先级 字体族名称(nameID 1)优先于排版用的字体族名称(nameID 16), 手动注册的最优先
+const (
+	priorityTypographic = iota + 1
+	priorityFamily
+	priorityManual
+)
+
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{
+		families:    map[string]*fontFamily{},
+		fallback:    DefaultFallbackFamily,
+		chains:      map[string][]string{},
+		substitutes: defaultSubstitutes(),
+		sources:     map[*truetype.Font]*fontSource{},
+	}
+}
+
+// Init 加载 fonts 中 fonts 目录下的全部字体到 DefaultFonts
+func Init(fonts fs.FS) error {
+	return DefaultFonts.LoadFS(fonts, "fonts")
+}
+
+// ErrUnsupportedOutlines 字体是 freetype 不能读取的 CFF 轮廓(OTF) 加载目录时这样的字体直接跳过
+var ErrUnsupportedOutlines = errors.New("CFF outlines are not supported")
+
+// LoadBytes 加载 TTF, OTF(TrueType 轮廓) 或 TTC 字体文件的内容
+// 字体全部是 CFF 轮廓时返回 ErrUnsupportedOutlines
+func (r *FontRegistry) LoadBytes(buf []byte) error {
+	offsets, err := collectionOffsets(buf)
+	if err != nil {
+		return err
+	}
+	var shared []byte
+	loaded := 0
+	for i, offset := range offsets {
+		if string(buf[offset:offset+4]) == "OTTO" {
+			continue
+		}
+		ft, err := parseCollectionFont(buf, &shared, i)
+		if err != nil {
+			return err
+		}
+		info := readFontInfo(buf, offset)
+		if len(info.families) == 0 {
+			if name := ft.Name(truetype.NameIDFontFamily); name != "" {
+				info.families = []string{name}
+			} else {
+				return errors.New("font has no family name")
+			}
+		}
+		r.addSource(ft, buf, i, offset)
+		for _, name := range info.families {
+			r.register(name, info.bold, info.italic, ft, priorityFamily)
+		}
+		for _, name := range info.typoFamilies {
+			r.register(name, info.bold, info.italic, ft, priorityTypographic)
+		}
+		loaded++
+	}
+	if loaded == 0 {
+		return ErrUnsupportedOutlines
+	}
+	return nil
+}
+
+// parseCollectionFont 解析字体文件中第 i 个字体
+// freetype 只解析 TTC 中的第一个字体, 其他字体共用一份数据副本 shared, 解析前把它的位置写到第一个的位置上
+// freetype 只在解析时读取文件头, 已解析的字体引用的表数据不变
+func parseCollectionFont(buf []byte, shared *[]byte, i int) (*truetype.Font, error) {
+	if i == 0 {
+		return truetype.Parse(buf)
+	}
+	if *shared == nil {
+		*shared = make([]byte, len(buf))
+		copy(*shared, buf)
+	}
+	copy((*shared)[12:16], buf[12+4*i:16+4*i])
+	return truetype.Parse(*shared)
+}
+
+// LoadFS 加载 fsys 中 dir 目录及子目录下全部的 .ttf .otf .ttc 字体
+// CFF 轮廓的字体直接跳过, 其他无法解析的字体会被跳过 并在返回的错误中列出
+func (r *FontRegistry) LoadFS(fsys fs.FS, dir string) error {
+	failed := make([]string, 0)
+	err := fs.WalkDir(fsys, dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() || !isFontFile(p) {
+			return nil
+		}
+		buf, err := fs.ReadFile(fsys, p)
+		if err == nil {
+			err = r.LoadBytes(buf)
+		}
+		if err != nil && !errors.Is(err, ErrUnsupportedOutlines) {
+			failed = append(failed, fmt.Sprintf("%s: %v", p, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to load fonts: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// LoadDir 加载操作系统目录 dir 及子目录下全部的字体
+func (r *FontRegistry) LoadDir(dir string) error {
+	return r.LoadFS(os.DirFS(dir), ".")
+}
+
+func isFontFile(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".ttf", ".otf", ".ttc":
+		return true
+	}
+	return false
+}
+
+// Register 以 family 为名称注册字体 可用于给已加载的字体添加别名
+func (r *FontRegistry) Register(family string, bold, italic bool, ft *truetype.Font) {
+	r.register(family, bold, italic, ft, priorityManual)
+}
+
+func (r *FontRegistry) register(family string, bold, italic bool, ft *truetype.Font, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetGlyphs()
+	key := familyKey(family)
+	fam, ok := r.families[key]
+	if !ok {
+		fam = &fontFamily{name: strings.TrimSpace(family)}
+		r.families[key] = fam
+		r.order = append(r.order, fam)
+	}
+	idx := fontStyleIndex(bold, italic)
+	if cur := fam.faces[idx]; cur == nil || priority > cur.priority {
+		fam.faces[idx] = &registeredFont{ft: ft, priority: priority}
+	}
+}
+
+// SetFallback 设置找不到字体时使用的字体族 默认为微软雅黑, 没有该字体时使用第一个注册的字体
+func (r *FontRegistry) SetFallback(family string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetGlyphs()
+	r.fallback = family
+}
+
+// SetFallbackChain 设置字体族 family 缺少字符时依次尝试的字体族, family 为空时设置所有字体共用的顺序
+// 如 SetFallbackChain("Arial", "微软雅黑", "Segoe UI Symbol")
+func (r *FontRegistry) SetFallbackChain(family string, chain ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetGlyphs()
+	r.chains[familyKey(family)] = chain
+}
+
+// fallbackChain 字体族缺少字符时依次尝试的字体族
+// 依次为该字体族的设置, 共用的设置, 备用字体, 其余已注册的字体族 查找结果由 glyphFont 缓存
+func (r *FontRegistry) fallbackChain(family string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	chain := append([]string{}, r.chains[familyKey(family)]...)
+	chain = append(chain, r.chains[""]...)
+	chain = append(chain, r.fallback)
+	for _, fam := range r.order {
+		chain = append(chain, fam.name)
+	}
+	return chain
+}
+
+// Families 已注册的字体族名称 按注册顺序
+func (r *FontRegistry) Families() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.order))
+	for _, fam := range r.order {
+		names = append(names, fam.name)
+	}
+	return names
+}
+
+// Lookup 查找字体 找不到字体族时依次使用替代字体和备用字体
+// 没有对应的粗体或斜体字体时依次尝试其他样式, boldSyn italicSyn 标记需要模拟的粗体和斜体, 没有任何字体时 ft 为nil
+func (r *FontRegistry) Lookup(family string, bold, italic bool) (ft *truetype.Font, boldSyn, italicSyn bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fam, _ := r.findFamily(family)
+	if fam == nil {
+		fam = r.fallbackFamily()
+	}
+	return fam.lookup(bold, italic)
+}
+
+// lookupFamily 查找字体 与 Lookup 相同, 但找不到字体族和替代字体时返回nil
+func (r *FontRegistry) lookupFamily(family string, bold, italic bool) (ft *truetype.Font, boldSyn, italicSyn bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fam, _ := r.findFamily(family)
+	return fam.lookup(bold, italic)
+}
+
+// findFamily 查找已注册的字体族 没有时查找第一个已注册的替代字体族, substitute 标记是否为替代字体
+func (r *FontRegistry) findFamily(family string) (fam *fontFamily, substitute bool) {
+	key := familyKey(family)
+	if fam, ok := r.families[key]; ok {
+		return fam, false
+	}
+	for _, sub := range r.substitutes[key] {
+		if fam, ok := r.families[familyKey(sub)]; ok {
+			return fam, true
+		}
+	}
+	return nil, false
+}
+
+func (fam *fontFamily) lookup(bold, italic bool) (ft *truetype.Font, boldSyn, italicSyn bool) {
+	if fam == nil {
+		return nil, false, false
+	}
+	styles := [][2]bool{{bold, italic}, {bold, false}, {false, italic}, {false, false}, {true, false}, {false, true}, {true, true}}
+	for _, st := range styles {
+		if f := fam.faces[fontStyleIndex(st[0], st[1])]; f != nil {
+			return f.ft, bold && !st[0], italic && !st[1]
+		}
+	}
+	return nil, false, false
+}
+
+func (r *FontRegistry) fallbackFamily() *fontFamily {
+	if fam, ok := r.families[familyKey(r.fallback)]; ok {
+		return fam
+	}
+	if len(r.order) > 0 {
+		return r.order[0]
+	}
+	return nil
+}
+
+// familyKey 字体族名称的索引 与 fontconfig 一样忽略大小写和空格
+func familyKey(family string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(family), " ", ""))
+}
+
+// fontStyleIndex 样式在 fontFamily.faces 中的位置
+func fontStyleIndex(bold, italic bool) int {
+	idx := 0
+	if bold {
+		idx |= 1
+	}
+	if italic {
+		idx |= 2
+	}
+	return idx
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// 注册了很多字体族时 后备顺序包含全部字体族
+func TestFallbackChainAllFamilies(t *testing.T) {
+	fonts := testFonts(t)
+	ft, _, _ := fonts.Lookup("Go", false, false)
+	for i := 0; i < 20; i++ {
+		fonts.Register(fmt.Sprintf("Alias %d", i), false, false, ft)
+	}
+	fonts.SetFallbackChain("Go", "Alias 3")
+	chain := fonts.fallbackChain("Go")
+	if chain[0] != "Alias 3" {
+		t.Errorf("chain starts with %q, want Alias 3", chain[0])
+	}
+	seen := map[string]bool{}
+	for _, family := range chain {
+		seen[family] = true
+	}
+	for _, family := range fonts.Families() {
+		if !seen[family] {
+			t.Errorf("%q is not in the fallback chain", family)
+		}
+	}
+}
+
+// makeCollection 把多个 TTF 合并为 TTC 表的位置改为相对于合并后的文件
+func makeCollection(fonts ...[]byte) []byte {
+	buf := make([]byte, 12+4*len(fonts))
+	copy(buf, "ttcf")
+	binary.BigEndian.PutUint32(buf[4:], 0x00010000)
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(fonts)))
+	for i, ft := range fonts {
+		base := len(buf)
+		binary.BigEndian.PutUint32(buf[12+4*i:], uint32(base))
+		ft = append([]byte(nil), ft...)
+		for j := 0; j < int(binary.BigEndian.Uint16(ft[4:])); j++ {
+			x := 12 + 16*j + 8
+			binary.BigEndian.PutUint32(ft[x:], binary.BigEndian.Uint32(ft[x:])+uint32(base))
+		}
+		buf = append(buf, ft...)
+	}
+	return buf
+}
+
+// cffFont 标记为 CFF 轮廓的字体
+func cffFont() []byte {
+	buf := append([]byte(nil), goregular.TTF...)
+	copy(buf, "OTTO")
+	return buf
+}
+
+func TestLoadBytesCollection(t *testing.T) {
+	fonts := NewFontRegistry()
+	if err := fonts.LoadBytes(makeCollection(goregular.TTF, gobold.TTF, goitalic.TTF)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fonts.Styles("Go"), " "); got != "regular bold italic" {
+		t.Errorf("styles %q, want regular bold italic", got)
+	}
+	for _, tt := range []struct {
+		bold, italic bool
+		subfamily    string
+	}{{false, false, "Regular"}, {true, false, "Bold"}, {false, true, "Italic"}} {
+		ft, _, _ := fonts.Lookup("Go", tt.bold, tt.italic)
+		if got := ft.Name(truetype.NameIDFontSubfamily); got != tt.subfamily {
+			t.Errorf("subfamily %q, want %q", got, tt.subfamily)
+		}
+		if ft.Index('a') == 0 {
+			t.Errorf("%s: no glyph for 'a'", tt.subfamily)
+		}
+	}
+}
+
+func TestLoadCFF(t *testing.T) {
+	if err := NewFontRegistry().LoadBytes(cffFont()); !errors.Is(err, ErrUnsupportedOutlines) {
+		t.Errorf("got %v, want ErrUnsupportedOutlines", err)
+	}
+	// 集合中的 CFF 字体跳过, 其他字体照常加载
+	fonts := NewFontRegistry()
+	if err := fonts.LoadBytes(makeCollection(cffFont(), gobold.TTF)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fonts.Styles("Go"), " "); got != "bold" {
+		t.Errorf("styles %q, want bold", got)
+	}
+	// 加载目录时 CFF 字体不算作错误
+	fsys := fstest.MapFS{
+		"fonts/cff.otf":    {Data: cffFont()},
+		"fonts/go.ttf":     {Data: goregular.TTF},
+		"fonts/broken.ttf": {Data: []byte("broken")},
+	}
+	fonts = NewFontRegistry()
+	err := fonts.LoadFS(fsys, "fonts")
+	if err == nil || !strings.Contains(err.Error(), "broken.ttf") || strings.Contains(err.Error(), "cff.otf") {
+		t.Errorf("got %v, want an error for broken.ttf only", err)
+	}
+	if got := strings.Join(fonts.Styles("Go"), " "); got != "regular" {
+		t.Errorf("styles %q, want regular", got)
+	}
+}
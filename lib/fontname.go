@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// 字体文件(sfnt)的 name OS/2 head 表 freetype 只能读取英文名称, 这里直接解析以取得本地化的字体名称
+
+const (
+	nameFamily      = 1
+	nameSubfamily   = 2
+	nameTypographic = 16
+)
+
+// fontInfo 字体的名称和样式
+type fontInfo struct {
+	// families 各语言的字体族名称(nameID 1)
+	families []string
+	// typoFamilies 各语言的字体族名称(nameID 16) 如 "Arial Black" 的字体族为 "Arial"
+	typoFamilies []string
+	subfamily    string
+	bold         bool
+	italic       bool
+}
+
+// collectionOffsets 字体文件中每个字体的表目录位置 TTC 中有多个字体
+func collectionOffsets(buf []byte) ([]int, error) {
+	if len(buf) < 12 {
+		return nil, errors.New("font data is too short")
+	}
+	if string(buf[:4]) != "ttcf" {
+		return []int{0}, nil
+	}
+	n := int(binary.BigEndian.Uint32(buf[8:]))
+	if n <= 0 || len(buf) < 12+4*n {
+		return nil, errors.New("bad font collection header")
+	}
+	offsets := make([]int, n)
+	for i := range offsets {
+		offsets[i] = int(binary.BigEndian.Uint32(buf[12+4*i:]))
+		if offsets[i] <= 0 || offsets[i]+12 > len(buf) {
+			return nil, errors.New("bad font collection offset")
+		}
+	}
+	return offsets, nil
+}
+
+// sfntTable 查找表目录在 offset 处的字体中名为 tag 的表
+func sfntTable(buf []byte, offset int, tag string) []byte {
+	if offset+12 > len(buf) {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(buf[offset+4:]))
+	for i := 0; i < n; i++ {
+		x := offset + 12 + 16*i
+		if x+16 > len(buf) {
+			return nil
+		}
+		if string(buf[x:x+4]) != tag {
+			continue
+		}
+		start := int(binary.BigEndian.Uint32(buf[x+8:]))
+		length := int(binary.BigEndian.Uint32(buf[x+12:]))
+		if start < 0 || length < 0 || start+length > len(buf) {
+			return nil
+		}
+		return buf[start : start+length]
+	}
+	return nil
+}
+
+// readFontInfo 读取表目录在 offset 处的字体的名称和样式
+func readFontInfo(buf []byte, offset int) fontInfo {
+	info := fontInfo{}
+	if name := sfntTable(buf, offset, "name"); len(name) >= 6 {
+		count := int(binary.BigEndian.Uint16(name[2:]))
+		storage := int(binary.BigEndian.Uint16(name[4:]))
+		for i := 0; i < count && 6+12*(i+1) <= len(name); i++ {
+			rec := name[6+12*i:]
+			platformID := binary.BigEndian.Uint16(rec[0:])
+			encodingID := binary.BigEndian.Uint16(rec[2:])
+			languageID := binary.BigEndian.Uint16(rec[4:])
+			nameID := binary.BigEndian.Uint16(rec[6:])
+			length := int(binary.BigEndian.Uint16(rec[8:]))
+			start := storage + int(binary.BigEndian.Uint16(rec[10:]))
+			if start+length > len(name) {
+				continue
+			}
+			s, ok := decodeName(platformID, encodingID, name[start:start+length])
+			if !ok || s == "" {
+				continue
+			}
+			switch nameID {
+			case nameFamily:
+				info.families = appendName(info.families, s)
+			case nameTypographic:
+				info.typoFamilies = appendName(info.typoFamilies, s)
+			case nameSubfamily:
+				// 英文的子族名称用于判断样式
+				english := (platformID == 3 && languageID == 0x409) || (platformID == 1 && languageID == 0)
+				if info.subfamily == "" || english {
+					info.subfamily = s
+				}
+			}
+		}
+	}
+	if os2 := sfntTable(buf, offset, "OS/2"); len(os2) >= 64 {
+		fsSelection := binary.BigEndian.Uint16(os2[62:])
+		info.italic = fsSelection&(1|1<<9) != 0
+		info.bold = fsSelection&(1<<5) != 0
+	} else if head := sfntTable(buf, offset, "head"); len(head) >= 46 {
+		macStyle := binary.BigEndian.Uint16(head[44:])
+		info.bold = macStyle&1 != 0
+		info.italic = macStyle&2 != 0
+	}
+	sub := strings.ToLower(info.subfamily)
+	info.bold = info.bold || strings.Contains(sub, "bold")
+	info.italic = info.italic || strings.Contains(sub, "italic") || strings.Contains(sub, "oblique")
+	return info
+}
+
+// decodeName 解码名称 Unicode 和 Windows 平台为 UTF-16BE, Mac 平台只支持 Roman 编码
+func decodeName(platformID, encodingID uint16, b []byte) (string, bool) {
+	switch {
+	case platformID == 0, platformID == 3 && (encodingID == 0 || encodingID == 1 || encodingID == 10):
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+		return strings.TrimSpace(string(utf16.Decode(u))), true
+	case platformID == 1 && encodingID == 0:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return strings.TrimSpace(string(r)), true
+	}
+	return "", false
+}
+
+func appendName(names []string, s string) []string {
+	for _, n := range names {
+		if strings.EqualFold(n, s) {
+			return names
+		}
+	}
+	return append(names, s)
+}
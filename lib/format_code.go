@@ -6,6 +6,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Do not edit these attributes once this struct is created. This struct should only be created by
@@ -23,19 +24,35 @@ type parsedNumberFormat struct {
 }
 
 type formatOptions struct {
-	isTimeFormat        bool
-	showPercent         bool
-	fullFormatString    string
-	reducedFormatString string
-	prefix              string
-	suffix              string
+	isTimeFormat     bool
+	fullFormatString string
 }
 
-func (fullFormat *parsedNumberFormat) formatNumericCell(rawValue string) (string, error) {
+// numberText 格式化后的文本 fill 为格式中 * 指定的填充字符, 绘制时在 text 的 fillAt 处重复到占满单元格宽度
+type numberText struct {
+	text   string
+	fill   rune
+	fillAt int
+	// general 使用常规格式时为 true, 宽度不够时按 value 减少显示的位数
+	general bool
+	value   float64
+}
+
+// formatNumericCell 格式化数字 rawValue, date1904 为工作簿是否使用 1904 日期系统
+func (fullFormat *parsedNumberFormat) formatNumericCell(rawValue string, date1904 bool) (string, error) {
+	nt, err := fullFormat.format(rawValue, date1904)
+	return nt.text, err
+}
+
+// format 格式化数字 rawValue 并保留填充字符的位置
+func (fullFormat *parsedNumberFormat) format(rawValue string, date1904 bool) (numberText, error) {
 	var numberFormat *formatOptions
 	floatVal, floatErr := strconv.ParseFloat(rawValue, 64)
 	if floatErr != nil {
-		return rawValue, floatErr
+		return numberText{text: rawValue}, floatErr
+	}
+	if math.IsInf(floatVal, 0) || math.IsNaN(floatVal) {
+		return numberText{text: rawValue}, fmt.Errorf("%s is not a finite number", rawValue)
 	}
 	// Choose the correct format. There can be different formats for positive, negative, and zero numbers.
 	// Excel only uses the zero format if the value is literally zero, even if the number is so small that it shows
@@ -45,7 +62,7 @@ func (fullFormat *parsedNumberFormat) formatNumericCell(rawValue string) (string
 	} else if floatVal < 0 {
 		// If format string specified a different format for negative numbers, then the number should be made positive
 		// before getting formatted. The format string itself will contain formatting that denotes a negative number and
-		// this formatting will end up in the prefix or suffix. Commonly if there is a negative format specified, the
+		// this formatting will end up in the literals. Commonly if there is a negative format specified, the
 		// number will get surrounded by parenthesis instead of showing it with a minus sign.
 		if fullFormat.negativeFormatExpectsPositive {
 			floatVal = math.Abs(floatVal)
@@ -55,30 +72,23 @@ func (fullFormat *parsedNumberFormat) formatNumericCell(rawValue string) (string
 		numberFormat = fullFormat.zeroFormat
 	}
 
-	if numberFormat.showPercent {
-		floatVal = 100 * floatVal
+	if numberFormat.isTimeFormat {
+		text, err := formatDate(floatVal, numberFormat.fullFormatString, date1904)
+		return numberText{text: text}, err
 	}
-	var formattedNum string
-	switch numberFormat.reducedFormatString {
-	case "0", "#,##0": // Int is "0"
-		// Previously this case would cast to int and print with %d, but that will not round the value correctly.
-		formattedNum = fmt.Sprintf("%.0f", floatVal)
-	case "0.0", "#,##0.0":
-		formattedNum = fmt.Sprintf("%.1f", floatVal)
-	case "0.00", "#,##0.00": // Float is "0.00"
-		formattedNum = fmt.Sprintf("%.2f", floatVal)
-	case "0.000", "#,##0.000":
-		formattedNum = fmt.Sprintf("%.3f", floatVal)
-	case "0.0000", "#,##0.0000":
-		formattedNum = fmt.Sprintf("%.4f", floatVal)
-	case "0.00e+00", "##0.0e+0":
-		formattedNum = fmt.Sprintf("%e", floatVal)
-	case "":
-		// Do nothing.
-	default:
-		return rawValue, nil
+	nt := formatNumber(floatVal, numberFormat.fullFormatString)
+	if numberFormat.fullFormatString == "general" {
+		nt.general, nt.value = true, floatVal
 	}
-	return numberFormat.prefix + formattedNum + numberFormat.suffix, nil
+	return nt, nil
+}
+
+// formatText 按文本节格式化文本 rawValue 没有文本节时文本不变
+func (fullFormat *parsedNumberFormat) formatText(rawValue string) numberText {
+	if fullFormat.textFormat == nil || fullFormat.textFormat.fullFormatString == "general" {
+		return numberText{text: rawValue}
+	}
+	return formatText(rawValue, fullFormat.textFormat.fullFormatString)
 }
 
 // Format strings are a little strange to compare because empty string
@@ -101,16 +111,23 @@ func parseFullNumberFormatString(numFmt string) *parsedNumberFormat {
 	parsedNumFmt := &parsedNumberFormat{
 		numFmt: numFmt,
 	}
-	if isTimeFormat(numFmt) {
-		// Time formats cannot have multiple groups separated by semicolons, there is only one format.
-		// Strings are unaffected by the time format.
+	formats, err := splitFormatOnSemicolon(numFmt)
+	if err == nil && isTimeFormat(formats[0]) {
+		// Only the first section of a time format is used, dates cannot be negative. Other sections such as the
+		// common "yyyy/m/d;@" only affect strings, and strings are unaffected by the time format.
+		timeFormat := &formatOptions{
+			isTimeFormat:     true,
+			fullFormatString: formats[0],
+		}
 		parsedNumFmt.isTimeFormat = true
+		parsedNumFmt.positiveFormat = timeFormat
+		parsedNumFmt.negativeFormat = timeFormat
+		parsedNumFmt.zeroFormat = timeFormat
 		parsedNumFmt.textFormat, _ = parseNumberFormatSection("general")
 		return parsedNumFmt
 	}
 
 	var fmtOptions []*formatOptions
-	formats, err := splitFormatOnSemicolon(numFmt)
 	if err == nil {
 		for _, formatSection := range formats {
 			parsedFormat, err := parseNumberFormatSection(formatSection)
@@ -197,176 +214,49 @@ func splitFormatOnSemicolon(format string) ([]string, error) {
 }
 
 var fallbackErrorFormat = &formatOptions{
-	fullFormatString:    "general",
-	reducedFormatString: "general",
+	fullFormatString: "general",
 }
 
-// parseNumberFormatSection takes in individual format and parses out most of the options.
-// Some options are parsed, removed from the string, and set as settings on formatOptions.
-// There remainder of the format string is put in the reducedFormatString attribute, and supported values for these
-// are handled in a switch in the Cell.FormattedValue() function.
-// Ideally more and more of the format string would be parsed out here into settings until there is no remainder string
-// at all.
-// Features that this supports:
-// - Time formats are detected, and marked in the options. Time format strings are handled when doing the formatting.
-//   The logic to detect time formats is currently not correct, and can catch formats that are not time formats as well
-//   as miss formats that are time formats.
-// - Color formats are detected and removed.
-// - Currency annotations are handled properly.
-// - Literal strings wrapped in quotes are handled and put into prefix or suffix.
-// - Numbers that should be percent are detected and marked in the options.
-// - Conditionals are detected and removed, but they are not obeyed. The conditional groups will be used just like the
-//   positive;negative;zero;string format groups. Here is an example of a conditional format: "[Red][<=100];[Blue][>100]"
-// Decoding the actual number formatting portion is out of scope, that is placed into reducedFormatString and is used
-// when formatting the string. The string there will be reduced to only the things in the formattingCharacters array.
-// Everything not in that array has been parsed out and put into formatOptions.
+// parseNumberFormatSection checks an individual format section. The section itself is interpreted by formatNumber
+// when formatting, here only unbalanced quotes and brackets are rejected so that the caller can fall back to general.
 func parseNumberFormatSection(fullFormat string) (*formatOptions, error) {
-	reducedFormat := strings.TrimSpace(fullFormat)
-
 	// general is the only format that does not use the normal format symbols notations
-	if compareFormatString(reducedFormat, "general") {
+	if compareFormatString(strings.TrimSpace(fullFormat), "general") {
 		return &formatOptions{
-			fullFormatString:    "general",
-			reducedFormatString: "general",
+			fullFormatString: "general",
 		}, nil
 	}
-
-	prefix, reducedFormat, showPercent1, err := parseLiterals(reducedFormat)
-	if err != nil {
-		return nil, err
-	}
-
-	reducedFormat, suffixFormat := splitFormatAndSuffixFormat(reducedFormat)
-
-	suffix, remaining, showPercent2, err := parseLiterals(suffixFormat)
-	if err != nil {
-		return nil, err
-	}
-	if len(remaining) > 0 {
-		// This paradigm of codes consisting of literals, number formats, then more literals is not always correct, they can
-		// actually be intertwined. Though 99% of the time number formats will not do this.
-		// Excel uses this format string for Social Security Numbers: 000\-00\-0000
-		// and this for US phone numbers: [<=9999999]###\-####;\(###\)\ ###\-####
-		return nil, errors.New("invalid or unsupported format string")
-	}
-
-	return &formatOptions{
-		fullFormatString:    fullFormat,
-		isTimeFormat:        false,
-		reducedFormatString: reducedFormat,
-		prefix:              prefix,
-		suffix:              suffix,
-		showPercent:         showPercent1 || showPercent2,
-	}, nil
-}
-
-// formattingCharacters will be left in the reducedNumberFormat
-// It is important that these be looked for in order so that the slash cases are handled correctly.
-// / (slash) is a fraction format if preceded by 0, #, or ?, otherwise it is not a formatting character
-// E- E+ e- e+ are scientific notation, but E, e, -, + are not formatting characters independently
-// \ (back slash) makes the next character a literal (not formatting)
-// " Anything in double quotes is not a formatting character
-// _ (underscore) skips the width of the next character, so the next character cannot be formatting
-var formattingCharacters = []string{"0/", "#/", "?/", "E-", "E+", "e-", "e+", "0", "#", "?", ".", ",", "@", "*"}
-
-// The following are also time format characters, but since this is only used for detecting, not decoding, they are
-// redundant here: ee, gg, ggg, rr, ss, mm, hh, yyyy, dd, ddd, dddd, mm, mmm, mmmm, mmmmm, ss.0000, ss.000, ss.00, ss.0
-// The .00 type format is very tricky, because it only counts if it comes after ss or s or [ss] or [s]
-// .00 is actually a valid number format by itself.
-var timeFormatCharacters = []string{"M", "D", "Y", "YY", "YYYY", "MM", "yyyy", "m", "d", "yy", "h", "m", "AM/PM", "A/P", "am/pm", "a/p", "r", "g", "e", "b1", "b2", "[hh]", "[h]", "[mm]", "[m]",
-	"s.0000", "s.000", "s.00", "s.0", "s", "[ss].0000", "[ss].000", "[ss].00", "[ss].0", "[ss]", "[s].0000", "[s].000", "[s].00", "[s].0", "[s]", "上", "午", "下"}
-
-func splitFormatAndSuffixFormat(format string) (string, string) {
-	var i int
-	for ; i < len(format); i++ {
-		curReducedFormat := format[i:]
-		var found bool
-		for _, special := range formattingCharacters {
-			if strings.HasPrefix(curReducedFormat, special) {
-				// Skip ahead if the special character was longer than length 1
-				i += len(special) - 1
-				found = true
-				break
-			}
-		}
-		if !found {
-			break
-		}
-	}
-	suffixFormat := format[i:]
-	format = format[:i]
-	return format, suffixFormat
-}
-
-func parseLiterals(format string) (string, string, bool, error) {
-	var prefix string
-	showPercent := false
-	for i := 0; i < len(format); i++ {
-		curReducedFormat := format[i:]
-		switch curReducedFormat[0] {
-		case '\\':
-			// If there is a slash, skip the next character, and add it to the prefix
-			if len(curReducedFormat) > 1 {
-				i++
-				prefix += curReducedFormat[1:2]
-			}
-		case '_':
-			// If there is an underscore, skip the next character, but don't add it to the prefix
-			if len(curReducedFormat) > 1 {
-				i++
-			}
-		case '*':
-			// Asterisks are used to repeat the next character to fill the full cell width.
-			// There isn't really a cell size in this context, so this will be ignored.
+	for i := 0; i < len(fullFormat); i++ {
+		switch fullFormat[i] {
+		case '\\', '_', '*':
+			// The next character is a literal, a space or a fill character.
+			i++
 		case '"':
-			// If there is a quote skip to the next quote, and add the quoted characters to the prefix
-			endQuoteIndex := strings.Index(curReducedFormat[1:], "\"")
+			endQuoteIndex := strings.IndexByte(fullFormat[i+1:], '"')
 			if endQuoteIndex == -1 {
-				return "", "", false, errors.New("invalid formatting code, unmatched double quote")
+				return nil, errors.New("invalid formatting code, unmatched double quote")
 			}
-			prefix = prefix + curReducedFormat[1:endQuoteIndex+1]
 			i += endQuoteIndex + 1
-		case '%':
-			showPercent = true
-			prefix += "%"
 		case '[':
-			// Brackets can be currency annotations (e.g. [$$-409])
-			// color formats (e.g. [color1] through [color56], as well as [red] etc.)
-			// conditionals (e.g. [>100], the valid conditionals are =, >, <, >=, <=, <>)
-			bracketIndex := strings.Index(curReducedFormat, "]")
+			bracketIndex := strings.IndexByte(fullFormat[i:], ']')
 			if bracketIndex == -1 {
-				return "", "", false, errors.New("invalid formatting code, invalid brackets")
-			}
-			// Currencies in Excel are annotated with this format: [$<Currency String>-<Language Info>]
-			// Currency String is something like $, ¥, €, or £
-			// Language Info is three hexadecimal characters
-			if len(curReducedFormat) > 2 && curReducedFormat[1] == '$' {
-				dashIndex := strings.Index(curReducedFormat, "-")
-				if dashIndex != -1 && dashIndex < bracketIndex {
-					// Get the currency symbol, and skip to the end of the currency format
-					prefix += curReducedFormat[2:dashIndex]
-				} else {
-					return "", "", false, errors.New("invalid formatting code, invalid currency annotation")
-				}
+				return nil, errors.New("invalid formatting code, invalid brackets")
 			}
 			i += bracketIndex
-		case '¥', '$', '-', '+', '/', '(', ')', ':', '!', '^', '&', '\'', '~', '{', '}', '<', '>', '=', ' ':
-			// These symbols are allowed to be used as literal without escaping
-			prefix += curReducedFormat[0:1]
-		default:
-			for _, special := range formattingCharacters {
-				if strings.HasPrefix(curReducedFormat, special) {
-					// This means we found the start of the actual number formatting portion, and should return.
-					return prefix, format[i:], showPercent, nil
-				}
-			}
-			// Symbols that don't have meaning and aren't in the exempt literal characters and are not escaped.
-			return "", "", false, errors.New("invalid formatting code: unsupported or unescaped characters")
 		}
 	}
-	return prefix, "", showPercent, nil
+	return &formatOptions{
+		fullFormatString: fullFormat,
+	}, nil
 }
 
+// The following are also time format characters, but since this is only used for detecting, not decoding, they are
+// redundant here: ee, gg, ggg, rr, ss, mm, hh, yyyy, dd, ddd, dddd, mm, mmm, mmmm, mmmmm, ss.0000, ss.000, ss.00, ss.0
+// The .00 type format is very tricky, because it only counts if it comes after ss or s or [ss] or [s]
+// .00 is actually a valid number format by itself.
+var timeFormatCharacters = []string{"M", "D", "Y", "YY", "YYYY", "MM", "yyyy", "m", "d", "yy", "h", "m", "AM/PM", "A/P", "am/pm", "a/p", "r", "g", "e", "b1", "b2", "[hh]", "[h]", "[mm]", "[m]",
+	"s.0000", "s.000", "s.00", "s.0", "s", "[ss].0000", "[ss].000", "[ss].00", "[ss].0", "[ss]", "[s].0000", "[s].000", "[s].00", "[s].0", "[s]", "上", "午", "下"}
+
 func skipToRune(runes []rune, r rune) (int, error) {
 	for i := 1; i < len(runes); i++ {
 		if runes[i] == r {
@@ -401,7 +291,7 @@ func isTimeFormat(format string) bool {
 				return false
 			}
 			i += endQuoteIndex + 1
-		case '$', '-', '+', '/', '(', ')', ':', '!', '^', '&', '\'', '~', '{', '}', '<', '>', '=', ' ':
+		case '$', '-', '+', '/', '(', ')', ':', '!', '^', '&', '\'', '~', '{', '}', '<', '>', '=', ' ', '.':
 			// These symbols are allowed to be used as literal without escaping
 		case ',':
 			// This is not documented in the XLSX spec as far as I can tell, but Excel and Numbers will include
@@ -435,6 +325,10 @@ func isTimeFormat(format string) bool {
 				i += bracketIndex
 				continue
 			}
+			if curReducedFormat[0] > unicode.MaxASCII {
+				// Excel accepts unquoted CJK literals in dates such as yyyy年m月d日.
+				continue
+			}
 			// Symbols that don't have meaning, aren't in the exempt literal characters, and aren't escaped are invalid.
 			// The string could still be a valid number format string.
 			return false
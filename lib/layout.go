@@ -0,0 +1,45 @@
+package lib
+
+import "image"
+
+// gridLayout 网格布局 colX 为每列的左边界, rowY 为每行的上边界, 最后一项为总宽高
+type gridLayout struct {
+	colX []int
+	rowY []int
+}
+
+func newGridLayout(widths, heights []int) *gridLayout {
+	l := &gridLayout{
+		colX: make([]int, len(widths)+1),
+		rowY: make([]int, len(heights)+1),
+	}
+	for i, w := range widths {
+		l.colX[i+1] = l.colX[i] + w
+	}
+	for i, h := range heights {
+		l.rowY[i+1] = l.rowY[i] + h
+	}
+	return l
+}
+
+func (l *gridLayout) width() int {
+	return l.colX[len(l.colX)-1]
+}
+
+func (l *gridLayout) height() int {
+	return l.rowY[len(l.rowY)-1]
+}
+
+// trackRect 单个网格单元的矩形
+func (l *gridLayout) trackRect(row, col int) image.Rectangle {
+	return image.Rect(l.colX[col], l.rowY[row], l.colX[col+1], l.rowY[row+1])
+}
+
+// cellRect 单元格绘制的矩形 合并单元格为整个合并区域
+func (l *gridLayout) cellRect(cell *ICell) image.Rectangle {
+	if cell.Merge == nil {
+		return l.trackRect(cell.Row, cell.Col)
+	}
+	m := cell.Merge
+	return image.Rect(l.colX[m.Col], l.rowY[m.Row], l.colX[m.Col+m.Cols], l.rowY[m.Row+m.Rows])
+}
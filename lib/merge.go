@@ -1,73 +1,89 @@
 package lib
 
 import (
-	"fmt"
 	"github.com/xuri/excelize/v2"
-	"strconv"
 )
 
+// IMerge 合并单元格 以绘制网格中的行列下标表示的矩形区域
 type IMerge struct {
-	Axis     string
-	Value    string
-	TypeX    bool
-	MrCells  []*ICell
-	MrCellsY []*ICell
+	Axis  string
+	Value string
+	// Origin 合并单元格原本的左上角单元格, 合并区域被截断时与 Axis 不同
+	Origin string
+	Row    int
+	Col    int
+	Rows   int
+	Cols   int
+}
+
+// IsMain 是否为合并区域的主单元格(左上角)
+func (m *IMerge) IsMain(row, col int) bool {
+	return m.Row == row && m.Col == col
+}
+
+// Contains 网格中的单元格是否在合并区域内
+func (m *IMerge) Contains(row, col int) bool {
+	return row >= m.Row && row < m.Row+m.Rows && col >= m.Col && col < m.Col+m.Cols
 }
 
 type MergeMG struct {
-	MainCells  map[string]*IMerge
-	HideCells  map[string]*IMerge
-	HideCellsY map[string]*IMerge
+	Merges []*IMerge
+	cells  map[[2]int]*IMerge
 }
 
-func NewMergeMG(mergeCells []excelize.MergeCell) *MergeMG {
+// NewMergeMG 将合并单元格映射到绘制网格 g, 跨越网格边界或隐藏行列的合并区域被截断到实际绘制的行列
+// 互相重叠的合并区域只保留先出现的一个
+func NewMergeMG(mergeCells []excelize.MergeCell, g *Grid) *MergeMG {
 	mg := &MergeMG{
-		MainCells:  map[string]*IMerge{},
-		HideCells:  map[string]*IMerge{},
-		HideCellsY: map[string]*IMerge{},
+		Merges: make([]*IMerge, 0, len(mergeCells)),
+		cells:  map[[2]int]*IMerge{},
 	}
 	for _, cell := range mergeCells {
-		sa := cell.GetStartAxis()
-		ea := cell.GetEndAxis()
+		sc, sr, err := excelize.CellNameToCoordinates(cell.GetStartAxis())
+		if err != nil {
+			continue
+		}
+		ec, er, err := excelize.CellNameToCoordinates(cell.GetEndAxis())
+		if err != nil {
+			continue
+		}
+		r0, r1, okR := gridIndexSpan(g.Rows, sr, er)
+		c0, c1, okC := gridIndexSpan(g.Cols, sc, ec)
+		if !okR || !okC || mg.overlaps(r0, c0, r1, c1) {
+			continue
+		}
+		axis, _ := excelize.CoordinatesToCellName(g.Cols[c0], g.Rows[r0])
 		imr := &IMerge{
-			Axis:     sa,
-			Value:    cell.GetCellValue(),
-			TypeX:    false,
-			MrCells:  make([]*ICell, 0),
-			MrCellsY: make([]*ICell, 0),
+			Axis:   axis,
+			Value:  cell.GetCellValue(),
+			Origin: cell.GetStartAxis(),
+			Row:    r0,
+			Col:    c0,
+			Rows:   r1 - r0 + 1,
+			Cols:   c1 - c0 + 1,
 		}
-		mg.MainCells[sa] = imr
-		// 判断是横还是纵
-		if sa[:1] == ea[:1] { // 纵
-			ss, es := sa[1:], ea[1:]
-			si, _ := strconv.Atoi(ss)
-			ei, _ := strconv.Atoi(es)
-			for i := si + 1; i <= ei; i++ {
-				axis := fmt.Sprintf("%s%d", sa[:1], i)
-				mg.HideCells[axis] = imr
-			}
-		} else { // 横
-			imr.TypeX = true
-			stl, etl := []rune(sa[:1]), []rune(ea[:1])
-			for i := stl[0] + 1; i <= etl[0]; i++ {
-				ac := []rune{i}
-				axis := fmt.Sprintf("%s%s", string(ac), sa[1:])
-				mg.HideCells[axis] = imr
-			}
-			// 先横后纵 多行合并
-			if sa[1:] != ea[1:] {
-				ss, es := sa[1:], ea[1:]
-				si, _ := strconv.Atoi(ss)
-				ei, _ := strconv.Atoi(es)
-				for i := si + 1; i <= ei; i++ {
-					for y := stl[0]; y <= etl[0]; y++ {
-						ac := []rune{y}
-						axis := fmt.Sprintf("%s%d", string(ac), i)
-						mg.HideCellsY[axis] = imr
-					}
-				}
+		mg.Merges = append(mg.Merges, imr)
+		for r := r0; r <= r1; r++ {
+			for c := c0; c <= c1; c++ {
+				mg.cells[[2]int{r, c}] = imr
 			}
 		}
 	}
 	return mg
 }
+
+// Get 网格中单元格所属的合并区域 不属于合并区域时返回nil
+func (mg *MergeMG) Get(row, col int) *IMerge {
+	return mg.cells[[2]int{row, col}]
+}
+
+func (mg *MergeMG) overlaps(r0, c0, r1, c1 int) bool {
+	for r := r0; r <= r1; r++ {
+		for c := c0; c <= c1; c++ {
+			if _, ok := mg.cells[[2]int{r, c}]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
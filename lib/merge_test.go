@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"image"
+	"testing"
+)
+
+// rangeGrid 区域 ref 内全部行列的网格
+func rangeGrid(t *testing.T, ref string) *Grid {
+	t.Helper()
+	rg, err := ParseRange(ref)
+	if err != nil {
+		t.Fatalf("ParseRange(%q) err %v", ref, err)
+	}
+	return rg.Grid()
+}
+
+func TestNewMergeMGWideColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		grid   string
+		merge  string
+		axis   string
+		origin string
+		row    int
+		col    int
+		rows   int
+		cols   int
+	}{
+		{"past Z", "A1:AC5", "Z2:AB3", "Z2", "Z2", 1, 25, 2, 3},
+		{"AA", "A1:AC5", "AA1:AA4", "AA1", "AA1", 0, 26, 4, 1},
+		{"AZ to BA", "AX1:BC3", "AZ1:BA2", "AZ1", "AZ1", 0, 2, 2, 2},
+		{"ZZ to AAA", "ZX1:AAC2", "ZZ1:AAB1", "ZZ1", "ZZ1", 0, 2, 1, 3},
+		{"XFD", "XFA1:XFD3", "XFC2:XFD3", "XFC2", "XFC2", 1, 2, 2, 2},
+		{"clipped at XFA", "XFA1:XFD3", "XEZ1:XFB1", "XFA1", "XEZ1", 0, 0, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := rangeGrid(t, tt.grid)
+			mg := NewMergeMG([]excelize.MergeCell{{tt.merge, "v"}}, g)
+			if len(mg.Merges) != 1 {
+				t.Fatalf("got %d merges, want 1", len(mg.Merges))
+			}
+			m := mg.Merges[0]
+			if m.Axis != tt.axis || m.Origin != tt.origin {
+				t.Errorf("axis %s origin %s, want %s %s", m.Axis, m.Origin, tt.axis, tt.origin)
+			}
+			if m.Row != tt.row || m.Col != tt.col || m.Rows != tt.rows || m.Cols != tt.cols {
+				t.Errorf("span (%d,%d) %dx%d, want (%d,%d) %dx%d", m.Row, m.Col, m.Rows, m.Cols, tt.row, tt.col, tt.rows, tt.cols)
+			}
+			if !mg.Get(tt.row, tt.col).IsMain(tt.row, tt.col) {
+				t.Errorf("(%d,%d) is not the main cell", tt.row, tt.col)
+			}
+		})
+	}
+}
+
+func TestNewMergeMGSpans(t *testing.T) {
+	tests := []struct {
+		name  string
+		merge string
+		row   int
+		col   int
+		rows  int
+		cols  int
+	}{
+		{"horizontal", "B2:D2", 1, 1, 1, 3},
+		{"vertical", "B2:B4", 1, 1, 3, 1},
+		{"2D", "B2:C4", 1, 1, 3, 2},
+		{"single cell", "C3:C3", 2, 2, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := NewMergeMG([]excelize.MergeCell{{tt.merge, "v"}}, rangeGrid(t, "A1:E5"))
+			if len(mg.Merges) != 1 {
+				t.Fatalf("got %d merges, want 1", len(mg.Merges))
+			}
+			m := mg.Merges[0]
+			if m.Row != tt.row || m.Col != tt.col || m.Rows != tt.rows || m.Cols != tt.cols {
+				t.Errorf("span (%d,%d) %dx%d, want (%d,%d) %dx%d", m.Row, m.Col, m.Rows, m.Cols, tt.row, tt.col, tt.rows, tt.cols)
+			}
+			if m.Value != "v" {
+				t.Errorf("value %q, want v", m.Value)
+			}
+			// 区域内的每个单元格都指向同一个合并区域 区域外的单元格不属于合并区域
+			for r := 0; r < 5; r++ {
+				for c := 0; c < 5; c++ {
+					inside := r >= tt.row && r < tt.row+tt.rows && c >= tt.col && c < tt.col+tt.cols
+					if got := mg.Get(r, c); (got == m) != inside || (got == nil) == inside {
+						t.Errorf("Get(%d, %d) = %v, inside %v", r, c, got, inside)
+					}
+					if m.IsMain(r, c) != (r == tt.row && c == tt.col) {
+						t.Errorf("IsMain(%d, %d) = %v", r, c, m.IsMain(r, c))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewMergeMGOverlaps(t *testing.T) {
+	merges := []excelize.MergeCell{
+		{"B2:C3", "first"},
+		{"C3:D4", "overlap"},
+		{"A1:A5", "beside"},
+		{"B3:B3", "inside"},
+	}
+	mg := NewMergeMG(merges, rangeGrid(t, "A1:E5"))
+	if len(mg.Merges) != 2 {
+		t.Fatalf("got %d merges, want 2", len(mg.Merges))
+	}
+	if mg.Merges[0].Value != "first" || mg.Merges[1].Value != "beside" {
+		t.Errorf("kept %q and %q, want first and beside", mg.Merges[0].Value, mg.Merges[1].Value)
+	}
+	if got := mg.Get(3, 3); got != nil {
+		t.Errorf("Get(3, 3) = %v, want nil for the dropped merge", got)
+	}
+	if got := mg.Get(2, 1); got != mg.Merges[0] {
+		t.Errorf("Get(2, 1) = %v, want the first merge", got)
+	}
+}
+
+func TestNewMergeMGClip(t *testing.T) {
+	tests := []struct {
+		name  string
+		grid  *Grid
+		merge string
+		ok    bool
+		axis  string
+		row   int
+		col   int
+		rows  int
+		cols  int
+	}{
+		{"clipped top left", &Grid{Rows: []int{3, 4, 5}, Cols: []int{3, 4, 5}}, "B2:D4", true, "C3", 0, 0, 2, 2},
+		{"clipped bottom right", &Grid{Rows: []int{1, 2, 3}, Cols: []int{1, 2}}, "B2:D4", true, "B2", 1, 1, 2, 1},
+		{"hidden row and column", &Grid{Rows: []int{1, 2, 4}, Cols: []int{1, 3, 4}}, "B2:D4", true, "C2", 1, 1, 2, 2},
+		{"outside", &Grid{Rows: []int{1, 2}, Cols: []int{5, 6}}, "B2:D4", false, "", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := NewMergeMG([]excelize.MergeCell{{tt.merge, "v"}}, tt.grid)
+			if !tt.ok {
+				if len(mg.Merges) != 0 {
+					t.Fatalf("got %d merges, want 0", len(mg.Merges))
+				}
+				return
+			}
+			if len(mg.Merges) != 1 {
+				t.Fatalf("got %d merges, want 1", len(mg.Merges))
+			}
+			m := mg.Merges[0]
+			if m.Axis != tt.axis || m.Origin != "B2" {
+				t.Errorf("axis %s origin %s, want %s B2", m.Axis, m.Origin, tt.axis)
+			}
+			if m.Row != tt.row || m.Col != tt.col || m.Rows != tt.rows || m.Cols != tt.cols {
+				t.Errorf("span (%d,%d) %dx%d, want (%d,%d) %dx%d", m.Row, m.Col, m.Rows, m.Cols, tt.row, tt.col, tt.rows, tt.cols)
+			}
+		})
+	}
+}
+
+func TestGridLayoutCellRect(t *testing.T) {
+	l := newGridLayout([]int{10, 20, 30}, []int{5, 6, 7})
+	if l.width() != 60 || l.height() != 18 {
+		t.Fatalf("size %dx%d, want 60x18", l.width(), l.height())
+	}
+	mg := NewMergeMG([]excelize.MergeCell{{"B1:C2", "v"}}, rangeGrid(t, "A1:C3"))
+	tests := []struct {
+		cell *ICell
+		want image.Rectangle
+	}{
+		{&ICell{Row: 0, Col: 0}, image.Rect(0, 0, 10, 5)},
+		{&ICell{Row: 2, Col: 2}, image.Rect(30, 11, 60, 18)},
+		{&ICell{Row: 0, Col: 1, Merge: mg.Get(0, 1)}, image.Rect(10, 0, 60, 11)},
+		{&ICell{Row: 1, Col: 2, Merge: mg.Get(1, 2)}, image.Rect(10, 0, 60, 11)},
+	}
+	for _, tt := range tests {
+		if got := l.cellRect(tt.cell); got != tt.want {
+			t.Errorf("cellRect(%d, %d) = %v, want %v", tt.cell.Row, tt.cell.Col, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package lib
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// numToken 数字格式中的一个元素
+type numToken struct {
+	kind numTokenKind
+	// text 文字的内容, 数字占位符 0 # ?, 科学计数的 E+ E-, 固定的分母
+	text string
+}
+
+type numTokenKind int
+
+const (
+	numLiteral numTokenKind = iota
+	numDigit
+	numPoint
+	numComma
+	numPercent
+	numExponent
+	numSlash
+	numDenominator
+	numGeneral
+	numText
+	numFill
+)
+
+// parseNumberSection 把数字格式的一节拆分为元素
+func parseNumberSection(section string) []numToken {
+	tokens := make([]numToken, 0, len(section))
+	runes := []rune(section)
+	literal := func(s string) {
+		tokens = append(tokens, numToken{kind: numLiteral, text: s})
+	}
+	hasPoint := false
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		rest := string(runes[i:])
+		switch {
+		case c == '"':
+			end := strings.IndexRune(string(runes[i+1:]), '"')
+			if end < 0 {
+				end = len(string(runes[i+1:]))
+			}
+			quoted := string(runes[i+1:])[:end]
+			literal(quoted)
+			i += utf8.RuneCountInString(quoted) + 1
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				literal(string(runes[i]))
+			}
+		case c == '_':
+			// 留出下一个字符的宽度
+			i++
+			literal(" ")
+		case c == '*':
+			if i+1 < len(runes) {
+				i++
+				tokens = append(tokens, numToken{kind: numFill, text: string(runes[i])})
+			}
+		case c == '[':
+			end := strings.IndexRune(rest, ']')
+			if end < 0 {
+				literal(rest)
+				return tokens
+			}
+			// [$€-407] 货币符号, 颜色和条件不显示
+			if inner := rest[1:end]; strings.HasPrefix(inner, "$") {
+				sym := inner[1:]
+				if dash := strings.IndexRune(sym, '-'); dash >= 0 {
+					sym = sym[:dash]
+				}
+				literal(sym)
+			}
+			i += utf8.RuneCountInString(rest[:end])
+		case len(rest) >= 7 && strings.EqualFold(rest[:7], "general"):
+			tokens = append(tokens, numToken{kind: numGeneral})
+			i += 6
+		case c == '0' || c == '#' || c == '?':
+			tokens = append(tokens, numToken{kind: numDigit, text: string(c)})
+		case c == '.' && !hasPoint:
+			hasPoint = true
+			tokens = append(tokens, numToken{kind: numPoint})
+		case c == ',':
+			tokens = append(tokens, numToken{kind: numComma})
+		case c == '%':
+			tokens = append(tokens, numToken{kind: numPercent})
+		case (c == 'E' || c == 'e') && i+1 < len(runes) && (runes[i+1] == '+' || runes[i+1] == '-'):
+			tokens = append(tokens, numToken{kind: numExponent, text: string(runes[i : i+2])})
+			i++
+		case c == '/' && len(tokens) > 0 && tokens[len(tokens)-1].kind == numDigit:
+			tokens = append(tokens, numToken{kind: numSlash})
+			// 固定的分母 如 # ??/16
+			j := i + 1
+			for j < len(runes) && runes[j] >= '0' && runes[j] <= '9' && (j > i+1 || runes[j] != '0') {
+				j++
+			}
+			if j > i+1 {
+				tokens = append(tokens, numToken{kind: numDenominator, text: string(runes[i+1 : j])})
+				i = j - 1
+			}
+		case c == '@':
+			tokens = append(tokens, numToken{kind: numText})
+		default:
+			literal(string(c))
+		}
+	}
+	return tokens
+}
+
+// formatNumber 按数字格式的一节 section 格式化 v
+// 支持数字占位符 0 # ?, 千位分隔符和按千缩放的逗号, 百分比, 科学计数, 分数, 文字, _ 空格和 * 填充
+func formatNumber(v float64, section string) numberText {
+	tokens := parseNumberSection(section)
+	neg := v < 0
+	v = math.Abs(v)
+
+	hasDigit, general := false, false
+	for _, t := range tokens {
+		switch t.kind {
+		case numDigit:
+			hasDigit = true
+		case numGeneral:
+			general = true
+		case numPercent:
+			v *= 100
+		}
+	}
+	var body []string
+	switch {
+	case general || !hasDigit:
+		body = formatGeneralTokens(v, tokens)
+	case indexToken(tokens, numSlash) >= 0:
+		body = formatFraction(v, tokens)
+	case indexToken(tokens, numExponent) >= 0:
+		body = formatScientific(v, tokens)
+	default:
+		body = formatDecimal(v, tokens)
+	}
+
+	prefix := ""
+	if neg {
+		prefix = "-"
+	}
+	return joinTokens(prefix, tokens, body)
+}
+
+// formatText 按数字格式的文本节 section 格式化文本 s, General 和 @ 处显示文本
+func formatText(s, section string) numberText {
+	tokens := parseNumberSection(section)
+	body := make([]string, len(tokens))
+	for i, t := range tokens {
+		switch t.kind {
+		case numGeneral, numText:
+			body[i] = s
+		default:
+			body[i] = tokenLiteral(t)
+		}
+	}
+	return joinTokens("", tokens, body)
+}
+
+// joinTokens 连接各占位符格式化后的文本 body 并记录第一个填充字符的位置
+func joinTokens(prefix string, tokens []numToken, body []string) numberText {
+	nt := numberText{}
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for i, t := range tokens {
+		if t.kind == numFill && nt.fill == 0 {
+			nt.fill, _ = utf8.DecodeRuneInString(t.text)
+			nt.fillAt = sb.Len()
+		}
+		sb.WriteString(body[i])
+	}
+	nt.text = sb.String()
+	return nt
+}
+
+// formatGeneralTokens 常规格式或没有数字占位符的格式 General 和 @ 处显示常规格式的数字
+func formatGeneralTokens(v float64, tokens []numToken) []string {
+	body := make([]string, len(tokens))
+	for i, t := range tokens {
+		switch t.kind {
+		case numGeneral, numText:
+			body[i] = formatGeneral(v)
+		default:
+			body[i] = tokenLiteral(t)
+		}
+	}
+	return body
+}
+
+// formatGeneral 常规格式 最多显示11个字符, 整数部分超过11位或很小的数使用科学计数
+func formatGeneral(v float64) string {
+	return formatGeneralWidth(v, generalWidth)
+}
+
+// generalWidth 常规格式最多显示的字符数 不含负号
+const generalWidth = 11
+
+// formatGeneralWidth 最多显示 width 个字符的常规格式 先减少小数位数, 放不下整数部分时使用科学计数
+// 科学计数也放不下时返回空字符串
+func formatGeneralWidth(v float64, width int) string {
+	if v == 0 {
+		return "0"
+	}
+	exp := int(math.Floor(math.Log10(math.Abs(v))))
+	fits := func(s string) bool {
+		return len(strings.TrimPrefix(s, "-")) <= width
+	}
+	switch {
+	case exp >= -4 && exp <= -1:
+		if s := trimZeros(strconv.FormatFloat(v, 'f', maxInt(width-2, 0), 64)); fits(s) && strings.Trim(s, "-0.") != "" {
+			return s
+		}
+	case exp >= -9 && exp <= 9:
+		if s := trimZeros(strconv.FormatFloat(v, 'f', 12, 64)); fits(s) {
+			return s
+		}
+		// 进位后整数部分可能多一位 如 9.96 保留1位小数为 10.0
+		for prec := maxInt(width-exp-2, 0); exp >= 0 && prec >= 0; prec-- {
+			if s := trimZeros(strconv.FormatFloat(v, 'f', prec, 64)); fits(s) {
+				return s
+			}
+		}
+	case exp == 10:
+		if s := strconv.FormatFloat(v, 'f', 0, 64); fits(s) {
+			return s
+		}
+	}
+	// 科学计数 尾数最多保留5位小数
+	expLen := len(strconv.Itoa(absInt(exp)))
+	if expLen < 2 {
+		expLen = 2
+	}
+	for prec := minInt(5, maxInt(width-expLen-4, 0)); prec >= 0; prec-- {
+		s := strconv.FormatFloat(v, 'E', prec, 64)
+		mant, e := s[:strings.IndexByte(s, 'E')], s[strings.IndexByte(s, 'E'):]
+		if s = trimZeros(mant) + e; fits(s) {
+			return s
+		}
+	}
+	return ""
+}
+
+// trimZeros 去掉小数末尾的0 和多余的小数点
+func trimZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// tokenLiteral 元素作为文字显示的内容
+func tokenLiteral(t numToken) string {
+	switch t.kind {
+	case numLiteral:
+		return t.text
+	case numPercent:
+		return "%"
+	case numPoint:
+		return "."
+	case numComma:
+		return ","
+	case numSlash:
+		return "/"
+	case numDenominator:
+		return t.text
+	}
+	return ""
+}
+
+func indexToken(tokens []numToken, kind numTokenKind) int {
+	for i, t := range tokens {
+		if t.kind == kind {
+			return i
+		}
+	}
+	return -1
+}
+
+// classifyCommas 区分逗号的作用 在整数部分的占位符之间为千位分隔符, 紧跟在占位符之后为按千缩放
+// 返回是否分组和缩放的次数, 起作用的逗号从 tokens 中变为空文字
+func classifyCommas(tokens []numToken, end int) (grouping bool, scale int) {
+	point := indexToken(tokens[:end], numPoint)
+	for i := 0; i < end; i++ {
+		if tokens[i].kind != numComma {
+			continue
+		}
+		j := i
+		for j < end && tokens[j].kind == numComma {
+			j++
+		}
+		prevDigit := i > 0 && tokens[i-1].kind == numDigit
+		nextDigit := j < end && tokens[j].kind == numDigit
+		switch {
+		case prevDigit && nextDigit && (point < 0 || i < point):
+			grouping = true
+		case prevDigit && !nextDigit:
+			scale += j - i
+		default:
+			i = j - 1
+			continue
+		}
+		for k := i; k < j; k++ {
+			tokens[k] = numToken{kind: numLiteral}
+		}
+		i = j - 1
+	}
+	return
+}
+
+// roundDigits 把 v 四舍五入到 decimals 位小数 返回整数部分和小数部分的数字
+// 与 Excel 一样只保留15位有效数字, 整数部分为0时返回空字符串
+func roundDigits(v float64, decimals int) (intPart, fracPart string) {
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', 15, 64), 64)
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	intPart, fracPart = s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, fracPart = s[:dot], s[dot+1:]
+	}
+	roundUp := len(fracPart) > decimals && fracPart[decimals] >= '5'
+	if len(fracPart) > decimals {
+		fracPart = fracPart[:decimals]
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+	if roundUp {
+		digits := []byte(intPart + fracPart)
+		i := len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i >= 0 {
+			digits[i]++
+		} else {
+			digits = append([]byte{'1'}, digits...)
+		}
+		intPart, fracPart = string(digits[:len(digits)-decimals]), string(digits[len(digits)-decimals:])
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	return
+}
+
+// fillInteger 把整数部分的数字 digits 按占位符 tokens[start:end] 从右向左填入 body
+// 多出的数字都放在第一个占位符处, 缺少的数字按占位符补 0 或空格
+func fillInteger(body []string, tokens []numToken, start, end int, digits string, grouping bool) {
+	places := make([]int, 0)
+	for i := start; i < end; i++ {
+		if tokens[i].kind == numDigit {
+			places = append(places, i)
+		}
+	}
+	if len(places) == 0 {
+		return
+	}
+	// 每个占位符对应的数字 不足时为占位符本身
+	parts := make([]string, len(places))
+	d := len(digits)
+	for k := len(places) - 1; k >= 0; k-- {
+		switch {
+		case k == 0 && d > 0:
+			parts[k] = digits[:d]
+			d = 0
+		case d > 0:
+			parts[k] = digits[d-1 : d]
+			d--
+		case tokens[places[k]].text == "0":
+			parts[k] = "0"
+		case tokens[places[k]].text == "?":
+			parts[k] = " "
+		}
+	}
+	if !grouping {
+		for k, i := range places {
+			body[i] = parts[k]
+		}
+		return
+	}
+	// 分组时整数部分作为一个整体 显示在第一个占位符处
+	all := strings.Join(parts, "")
+	trimmed := strings.TrimLeft(all, " ")
+	body[places[0]] = all[:len(all)-len(trimmed)] + groupThousands(trimmed)
+}
+
+// groupThousands 每三位数字插入千位分隔符
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var sb strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// fillFraction 把小数部分的数字 digits 按占位符 tokens[start:end] 从左向右填入 body
+// 末尾的0 对应 # 时不显示, 对应 ? 时显示为空格
+func fillFraction(body []string, tokens []numToken, start, end int, digits string) {
+	places := make([]int, 0)
+	for i := start; i < end; i++ {
+		if tokens[i].kind == numDigit {
+			places = append(places, i)
+		}
+	}
+	trailing := true
+	for k := len(places) - 1; k >= 0; k-- {
+		digit, ph := string(digits[k]), tokens[places[k]].text
+		if trailing && digit == "0" && ph != "0" {
+			if ph == "?" {
+				body[places[k]] = " "
+			}
+			continue
+		}
+		trailing = false
+		body[places[k]] = digit
+	}
+}
+
+// countDigits tokens[start:end] 中数字占位符的个数
+func countDigits(tokens []numToken, start, end int) int {
+	n := 0
+	for i := start; i < end; i++ {
+		if tokens[i].kind == numDigit {
+			n++
+		}
+	}
+	return n
+}
+
+// literalBody 除数字占位符外的元素按文字显示
+func literalBody(tokens []numToken) []string {
+	body := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t.kind != numDigit {
+			body[i] = tokenLiteral(t)
+		}
+	}
+	return body
+}
+
+// formatDecimal 整数和小数
+func formatDecimal(v float64, tokens []numToken) []string {
+	grouping, scale := classifyCommas(tokens, len(tokens))
+	v /= math.Pow(1000, float64(scale))
+	point := indexToken(tokens, numPoint)
+	intEnd := point
+	if point < 0 {
+		intEnd = len(tokens)
+	}
+	decimals := countDigits(tokens, intEnd, len(tokens))
+	intPart, fracPart := roundDigits(v, decimals)
+	body := literalBody(tokens)
+	fillInteger(body, tokens, 0, intEnd, intPart, grouping)
+	if point >= 0 {
+		fillFraction(body, tokens, point, len(tokens), fracPart)
+	}
+	return body
+}
+
+// formatScientific 科学计数 整数部分以 # 开头时指数为整数部分位数的倍数(如 ##0.0E+0)
+func formatScientific(v float64, tokens []numToken) []string {
+	ei := indexToken(tokens, numExponent)
+	grouping, _ := classifyCommas(tokens, ei)
+	point := indexToken(tokens[:ei], numPoint)
+	intEnd := point
+	if point < 0 {
+		intEnd = ei
+	}
+	intPlaces := countDigits(tokens, 0, intEnd)
+	decimals := countDigits(tokens, intEnd, ei)
+	engineering := false
+	for _, t := range tokens[:intEnd] {
+		if t.kind == numDigit {
+			engineering = t.text == "#" && intPlaces > 1
+			break
+		}
+	}
+	step := 1
+	if engineering {
+		step = intPlaces
+	}
+	exp := 0
+	var intPart, fracPart string
+	for try := 0; try < 2; try++ {
+		if v != 0 {
+			e := int(math.Floor(math.Log10(v)))
+			if engineering {
+				exp = int(math.Floor(float64(e)/float64(step))) * step
+			} else {
+				exp = e - maxInt(intPlaces-1, 0)
+			}
+		}
+		exp += try * step
+		intPart, fracPart = roundDigits(v/math.Pow(10, float64(exp)), decimals)
+		// 四舍五入后进位到下一个数量级时增大指数
+		if len(intPart) <= maxInt(intPlaces, 1) {
+			break
+		}
+	}
+	body := literalBody(tokens)
+	fillInteger(body, tokens, 0, intEnd, intPart, grouping)
+	if point >= 0 {
+		fillFraction(body, tokens, point, ei, fracPart)
+	}
+	sign := ""
+	if exp < 0 {
+		sign = "-"
+	} else if tokens[ei].text[1] == '+' {
+		sign = "+"
+	}
+	body[ei] = tokens[ei].text[:1] + sign
+	expDigits := strconv.Itoa(absInt(exp))
+	fillInteger(body, tokens, ei+1, len(tokens), strings.TrimLeft(expDigits, "0"), false)
+	return body
+}
+
+// formatFraction 分数 如 # ?/?, # ??/16, 没有整数部分时显示假分数
+func formatFraction(v float64, tokens []numToken) []string {
+	slash := indexToken(tokens, numSlash)
+	// 分子为分数线前连续的占位符 再往前的占位符为整数部分
+	numStart := slash
+	for numStart > 0 && tokens[numStart-1].kind == numDigit {
+		numStart--
+	}
+	intEnd := 0
+	for i := numStart - 1; i >= 0; i-- {
+		if tokens[i].kind == numDigit {
+			intEnd = i + 1
+			break
+		}
+	}
+	grouping, _ := classifyCommas(tokens, intEnd)
+	denEnd := slash + 1
+	for denEnd < len(tokens) && (tokens[denEnd].kind == numDigit || tokens[denEnd].kind == numDenominator) {
+		denEnd++
+	}
+
+	whole, frac := 0.0, v
+	if intEnd > 0 {
+		whole = math.Floor(v)
+		frac = v - whole
+	}
+	var num, den int
+	if fixed := indexToken(tokens[slash:denEnd], numDenominator); fixed >= 0 {
+		den, _ = strconv.Atoi(tokens[slash+fixed].text)
+		num = int(math.Round(frac * float64(den)))
+	} else {
+		maxDen := int(math.Pow(10, float64(countDigits(tokens, slash, denEnd)))) - 1
+		num, den = approximateFraction(frac, minInt(maxDen, 99999))
+	}
+	if intEnd > 0 && num == den {
+		whole++
+		num = 0
+	}
+
+	body := literalBody(tokens)
+	wholeDigits := strconv.FormatFloat(whole, 'f', 0, 64)
+	if whole == 0 && num != 0 {
+		wholeDigits = ""
+	}
+	fillInteger(body, tokens, 0, intEnd, wholeDigits, grouping)
+	if intEnd > 0 && num == 0 {
+		// 没有分数部分时分子, 分数线和分母都显示为空格
+		for i := numStart; i < denEnd; i++ {
+			body[i] = strings.Repeat(" ", utf8.RuneCountInString(body[i])+boolToInt(tokens[i].kind == numDigit && body[i] == ""))
+		}
+		return body
+	}
+	fillInteger(body, tokens, numStart, slash, strconv.Itoa(num), false)
+	// 分母的 ? 在右侧补空格
+	denDigits := strconv.Itoa(den)
+	places := make([]int, 0)
+	for i := slash + 1; i < denEnd; i++ {
+		if tokens[i].kind == numDigit {
+			places = append(places, i)
+		}
+	}
+	for k, i := range places {
+		switch {
+		case k == 0:
+			body[i] = denDigits[:maxInt(1, len(denDigits)-len(places)+1)]
+		case len(denDigits)-len(places)+k < len(denDigits) && len(denDigits)-len(places)+k >= 1:
+			body[i] = denDigits[len(denDigits)-len(places)+k : len(denDigits)-len(places)+k+1]
+		case tokens[i].text == "?":
+			body[i] = " "
+		}
+	}
+	return body
+}
+
+// approximateFraction 分母不超过 maxDen 时最接近 v 的分数
+func approximateFraction(v float64, maxDen int) (num, den int) {
+	num, den = int(math.Round(v)), 1
+	best := math.Abs(v - float64(num))
+	for d := 2; d <= maxDen && best > 0; d++ {
+		n := int(math.Round(v * float64(d)))
+		if diff := math.Abs(v - float64(n)/float64(d)); diff < best {
+			num, den, best = n, d, diff
+		}
+	}
+	return
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
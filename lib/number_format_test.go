@@ -0,0 +1,431 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"strconv"
+	"testing"
+)
+
+// Excel 中显示的结果
+
+func TestFormatNumericCell(t *testing.T) {
+	tests := []struct {
+		value float64
+		code  string
+		want  string
+	}{
+		// 千位分隔符
+		{1234.5, "#,##0", "1,235"},
+		{1234567.891, "#,##0.00", "1,234,567.89"},
+		{999.5, "#,##0", "1,000"},
+		{12, "#,##0", "12"},
+		{0, "#,##0", "0"},
+		{0.5, "#,###", "1"},
+		{0.4, "#,###", ""},
+		{-1234567, "#,##0", "-1,234,567"},
+		// 按千缩放
+		{1234567, "#,##0,", "1,235"},
+		{1234567, "0.0,,", "1.2"},
+		{1234567, `#,##0,,"M"`, "1M"},
+		{1234567, "0,", "1235"},
+		{1234567, `#,##0,"K"`, "1,235K"},
+		// 数字占位符
+		{42, "00000", "00042"},
+		{123456789, "000-00-0000", "123-45-6789"},
+		{1.5, "0.0#", "1.5"},
+		{1.256, "0.0#", "1.26"},
+		{1.5, "0.0?", "1.5 "},
+		{12.3, "???.??", " 12.3 "},
+		{0.5, "?.?", " .5"},
+		{0.5, "#.##", ".5"},
+		{0, "#", ""},
+		{-2.5, "0", "-3"},
+		{-0.4, "0", "-0"},
+		{0.125, "0.00", "0.13"},
+		{1.005, "0.00", "1.01"},
+		{0.1 + 0.2, "0.00000000000000000", "0.30000000000000000"},
+		// 百分比
+		{0.256, "0%", "26%"},
+		{0.25, "0.00%", "25.00%"},
+		{-0.05, "0%", "-5%"},
+		// 科学计数
+		{45123.4567, "0.00E+00", "4.51E+04"},
+		{0.000123, "0.00E+00", "1.23E-04"},
+		{12345, "0.000E-0", "1.235E4"},
+		{0.00012, "0.0E-0", "1.2E-4"},
+		{0, "0.00E+00", "0.00E+00"},
+		{9.996, "0.00E+00", "1.00E+01"},
+		{-12345, "0.00E+00", "-1.23E+04"},
+		{12345, "0.00e+00", "1.23e+04"},
+		// 工程计数 指数为整数部分位数的倍数
+		{45123.4567, "##0.0E+0", "45.1E+3"},
+		{1234567, "##0.0E+0", "1.2E+6"},
+		{0.00123, "##0.0E+0", "1.2E-3"},
+		{123456, "##0.0E+0", "123.5E+3"},
+		// 固定分母的分数
+		{2.3, "# ??/16", "2  5/16"},
+		{5.25, "# ?/8", "5 2/8"},
+		{0.5, "# ?/4", " 2/4"},
+		// 近似的分数
+		{1.5, "# ?/?", "1 1/2"},
+		{0.5, "# ?/?", " 1/2"},
+		{3.14159, "# ??/??", "3 14/99"},
+		{0.75, "?/?", "3/4"},
+		{1.75, "?/?", "7/4"},
+		{2, "# ?/?", "2    "},
+		{0.999, "# ?/?", "1    "},
+		{-1.5, "# ?/?", "-1 1/2"},
+		{45123.4567, "# ???/???", "45123 443/970"},
+		// 文字和转义
+		{1234.5, `"$"#,##0.00`, "$1,234.50"},
+		{5, `\(0\)`, "(5)"},
+		{12, `0 "kg"`, "12 kg"},
+		{1, `0" units"`, "1 units"},
+		{1234, `#,##0" 元"`, "1,234 元"},
+		{1000, `[$€-407]#,##0`, "€1,000"},
+		{5, `[Red]0.00`, "5.00"},
+		{5, `[>100]0;0.0`, "5"},
+		{12, `"No. "@`, "No. 12"},
+		// _ 空格和 * 填充
+		{5, `0_)`, "5 "},
+		{5, `_(0_)`, " 5 "},
+		{12, `* #,##0`, "12"},
+		{42, `0*-`, "42"},
+		// 正数, 负数, 零, 文本的格式
+		{-1234.5, "#,##0;(#,##0)", "(1,235)"},
+		{0, `0;-0;"zero"`, "zero"},
+		{-5, `0;-0;"zero"`, "-5"},
+		{0, "0.00;-0.00", "0.00"},
+		{-5, `0;[Red]0`, "5"},
+		// 常规格式
+		{1.0 / 3, "General", "0.333333333"},
+		{123456789012, "General", "1.23457E+11"},
+		{45123.4567, "General", "45123.4567"},
+		{1e-10, "General", "1E-10"},
+		{0.0001, "General", "0.0001"},
+		{12345678901, "General", "12345678901"},
+		{-1234.5, "General", "-1234.5"},
+		{100000, "General", "100000"},
+		{0.1 + 0.2, "General", "0.3"},
+		{0, "General", "0"},
+		{1234.5, "", "1234.5"},
+	}
+	for _, tt := range tests {
+		got, err := parseFullNumberFormatString(tt.code).formatNumericCell(strconv.FormatFloat(tt.value, 'f', -1, 64), false)
+		if err != nil {
+			t.Errorf("%q %v: err %v", tt.code, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q %v: got %q, want %q", tt.code, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDateSerial(t *testing.T) {
+	tests := []struct {
+		value    float64
+		code     string
+		date1904 bool
+		want     string
+	}{
+		// 1900 日期系统把1900年当作闰年 序号60是不存在的1900年2月29日
+		{0, "yyyy-mm-dd", false, "1900-01-00"},
+		{1, "yyyy-mm-dd", false, "1900-01-01"},
+		{59, "yyyy-mm-dd", false, "1900-02-28"},
+		{60, "yyyy-mm-dd", false, "1900-02-29"},
+		{61, "yyyy-mm-dd", false, "1900-03-01"},
+		{60, "dddd", false, "Wednesday"},
+		{61, "dddd", false, "Thursday"},
+		{45123, "yyyy-mm-dd dddd", false, "2023-07-16 Sunday"},
+		{2958465, "yyyy-mm-dd", false, "9999-12-31"},
+		// 1904 日期系统
+		{0, "yyyy-mm-dd", true, "1904-01-01"},
+		{60, "yyyy-mm-dd", true, "1904-03-01"},
+		{43661.4567, "yyyy-mm-dd hh:mm", true, "2023-07-16 10:57"},
+		// 月份和星期的名称
+		{45123, "mmmm d, yyyy", false, "July 16, 2023"},
+		{45123, "mmm", false, "Jul"},
+		{45123, "mmmmm", false, "J"},
+		{45123, "ddd, d-mmm-yy", false, "Sun, 16-Jul-23"},
+		// 时间
+		{0.75, "h:mm AM/PM", false, "6:00 PM"},
+		{0, "h AM/PM", false, "12 AM"},
+		{0.5, "h A/P", false, "12 P"},
+		{0.4567, "h:mm", false, "10:57"},
+		{0.4567, "h:mm:ss", false, "10:57:39"},
+		{0.4567, "上午/下午h:mm", false, "上午10:57"},
+		// 经过的时间
+		{1.5, "[h]:mm", false, "36:00"},
+		{2.25, "[h]:mm:ss", false, "54:00:00"},
+		{0.5, "[m]", false, "720"},
+		{90.0 / 86400, "[s]", false, "90"},
+		{45123.4567, "[h]:mm:ss", false, "1082962:57:39"},
+		// 秒的小数
+		{0.4567, "hh:mm:ss.00", false, "10:57:38.88"},
+		{0.4567, "mm:ss.0", false, "57:38.9"},
+		{0.4567, "h:mm:ss.000", false, "10:57:38.880"},
+		// 只使用第一节
+		{45123, "yyyy/m/d;@", false, "2023/7/16"},
+	}
+	for _, tt := range tests {
+		got, err := parseFullNumberFormatString(tt.code).formatNumericCell(strconv.FormatFloat(tt.value, 'f', -1, 64), tt.date1904)
+		if err != nil {
+			t.Errorf("%q %v: err %v", tt.code, tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q %v (1904 %v): got %q, want %q", tt.code, tt.value, tt.date1904, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltInNumFmts(t *testing.T) {
+	const value = 45123.4567
+	enUS := map[int]string{
+		0:  "45123.4567",
+		1:  "45123",
+		2:  "45123.46",
+		3:  "45,123",
+		4:  "45,123.46",
+		5:  "$45,123 ",
+		6:  "$45,123 ",
+		7:  "$45,123.46 ",
+		8:  "$45,123.46 ",
+		9:  "4512346%",
+		10: "4512345.67%",
+		11: "4.51E+04",
+		12: "45123 4/9",
+		13: "45123 37/81",
+		14: "7/16/2023",
+		15: "16-Jul-23",
+		16: "16-Jul",
+		17: "Jul-23",
+		18: "10:57 AM",
+		19: "10:57:39 AM",
+		20: "10:57",
+		21: "10:57:39",
+		22: "7/16/2023 10:57",
+		37: "45,123 ",
+		38: "45,123 ",
+		39: "45,123.46",
+		40: "45,123.46",
+		41: " 45,123 ",
+		42: " $45,123 ",
+		43: " 45,123.46 ",
+		44: " $45,123.46 ",
+		45: "57:39",
+		46: "1082962:57:39",
+		47: "57:38.9",
+		48: "45.1E+3",
+		49: "45123.4567",
+	}
+	locales := map[string]map[int]string{
+		"en-US": {},
+		"zh-CN": {
+			5: "¥45,123", 6: "¥45,123", 7: "¥45,123.46", 8: "¥45,123.46",
+			14: "2023/7/16", 22: "2023/7/16 10:57",
+			27: "2023年7月", 28: "7月16日", 29: "7月16日", 30: "7-16-23", 31: "2023年7月16日",
+			32: "10时57分", 33: "10时57分39秒", 34: "上午10时57分", 35: "上午10时57分39秒", 36: "2023年7月",
+			42: " ¥45,123 ", 44: " ¥45,123.46 ",
+			50: "2023年7月", 51: "7月16日", 52: "2023年7月", 53: "7月16日", 54: "7月16日",
+			55: "上午10时57分", 56: "上午10时57分39秒", 57: "2023年7月", 58: "7月16日",
+		},
+		"zh-TW": {
+			5: "NT$45,123 ", 6: "NT$45,123 ", 7: "NT$45,123.46 ", 8: "NT$45,123.46 ",
+			14: "2023/7/16", 22: "2023/7/16 10:57",
+			27: "112/7/16", 28: "112年7月16日", 29: "112年7月16日", 30: "7/16/23", 31: "2023年7月16日",
+			32: "10時57分", 33: "10時57分39秒", 34: "上午10時57分", 35: "上午10時57分39秒", 36: "112/7/16",
+			50: "112/7/16", 51: "112年7月16日", 52: "上午10時57分", 53: "上午10時57分39秒", 54: "112年7月16日",
+			55: "上午10時57分", 56: "上午10時57分39秒", 57: "112/7/16", 58: "112年7月16日",
+		},
+		"ja-JP": {
+			5: "¥45,123", 6: "¥45,123", 7: "¥45,123.46", 8: "¥45,123.46",
+			14: "2023/7/16", 22: "2023/7/16 10:57",
+			27: "R5.7.16", 28: "令和5年7月16日", 29: "令和5年7月16日", 30: "7/16/23", 31: "2023年7月16日",
+			32: "10時57分", 33: "10時57分39秒", 34: "2023年7月", 35: "7月16日", 36: "R5.7.16",
+			50: "R5.7.16", 51: "令和5年7月16日", 52: "2023年7月", 53: "7月16日", 54: "令和5年7月16日",
+			55: "2023年7月", 56: "7月16日", 57: "R5.7.16", 58: "令和5年7月16日",
+		},
+		"ko-KR": {
+			5: "₩45,123", 6: "₩45,123", 7: "₩45,123.46", 8: "₩45,123.46",
+			14: "2023-07-16", 22: "2023-07-16 10:57",
+			27: "2023年 07月 16日", 28: "07-16", 29: "07-16", 30: "07-16-23", 31: "2023년 07월 16일",
+			32: "10시 57분", 33: "10시 57분 39초", 34: "2023-07-16", 35: "2023-07-16", 36: "2023年 07月 16日",
+			50: "2023年 07月 16日", 51: "07-16", 52: "2023-07-16", 53: "2023-07-16", 54: "07-16",
+			55: "2023-07-16", 56: "2023-07-16", 57: "2023年 07月 16日", 58: "07-16",
+		},
+	}
+	for locale, overrides := range locales {
+		for id := 0; id <= 58; id++ {
+			want, defined := overrides[id]
+			if !defined {
+				want, defined = enUS[id]
+			}
+			code, ok := builtInNumFmt(id, locale)
+			if ok != defined {
+				t.Errorf("%s %d: defined %v, want %v", locale, id, ok, defined)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			got, err := parseFullNumberFormatString(code).formatNumericCell(strconv.FormatFloat(value, 'f', -1, 64), false)
+			if err != nil {
+				t.Errorf("%s %d %q: err %v", locale, id, code, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s %d %q: got %q, want %q", locale, id, code, got, want)
+			}
+		}
+	}
+}
+
+func TestBuiltInNumFmtSections(t *testing.T) {
+	tests := []struct {
+		id     int
+		locale string
+		value  float64
+		want   string
+	}{
+		{5, "en-US", -1234.5, "($1,235)"},
+		{7, "en-US", -1234.5, "($1,234.50)"},
+		{5, "zh-CN", -1234.5, "¥-1,235"},
+		{37, "en-US", -1234.5, "(1,235)"},
+		{39, "en-US", -1234.5, "(1,234.50)"},
+		{41, "en-US", -1234.5, " (1,235)"},
+		{41, "en-US", 0, " - "},
+		{43, "en-US", 0, " -   "},
+		{44, "zh-CN", 0, " ¥-   "},
+	}
+	for _, tt := range tests {
+		code, _ := builtInNumFmt(tt.id, tt.locale)
+		got, err := parseFullNumberFormatString(code).formatNumericCell(strconv.FormatFloat(tt.value, 'f', -1, 64), false)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %d %v: got %q err %v, want %q", tt.locale, tt.id, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatNumberFill(t *testing.T) {
+	tests := []struct {
+		code   string
+		value  string
+		text   string
+		fill   rune
+		fillAt int
+	}{
+		{`_("$"* #,##0.00_)`, "1234.5", " $1,234.50 ", ' ', 2},
+		{`0*-`, "42", "42", '-', 2},
+		{`**0`, "7", "7", '*', 0},
+		{`0.00`, "7", "7.00", 0, 0},
+		{`_ "¥"* #,##0_ ;_ "¥"* \-#,##0_ `, "-5", " ¥-5 ", ' ', 3},
+	}
+	for _, tt := range tests {
+		nt, err := parseFullNumberFormatString(tt.code).format(tt.value, false)
+		if err != nil {
+			t.Errorf("%q: err %v", tt.code, err)
+			continue
+		}
+		if nt.text != tt.text || nt.fill != tt.fill || nt.fillAt != tt.fillAt {
+			t.Errorf("%q: got %q %q@%d, want %q %q@%d", tt.code, nt.text, nt.fill, nt.fillAt, tt.text, tt.fill, tt.fillAt)
+		}
+	}
+}
+
+func TestFormatGeneralWidth(t *testing.T) {
+	tests := []struct {
+		value float64
+		width int
+		want  string
+	}{
+		{1234.5678, 11, "1234.5678"},
+		{1234.5678, 8, "1234.568"},
+		{1234.5678, 4, "1235"},
+		{1234.5678, 3, ""},
+		{123456789012345, 8, "1.23E+14"},
+		{123456789012345, 5, "1E+14"},
+		{0.000123456789, 7, "0.00012"},
+		{12345678.9, 5, "1E+07"},
+		{-1234.5678, 8, "-1234.568"},
+	}
+	for _, tt := range tests {
+		if got := formatGeneralWidth(tt.value, tt.width); got != tt.want {
+			t.Errorf("%v width %d: got %q, want %q", tt.value, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestFormatNonFinite(t *testing.T) {
+	for _, s := range []string{"Infinity", "-Inf", "NaN", "+inf"} {
+		if IsNum(s) {
+			t.Errorf("IsNum(%q) = true", s)
+		}
+		for _, code := range []string{"General", "@", "0.00"} {
+			if _, err := parseFullNumberFormatString(code).formatNumericCell(s, false); err == nil {
+				t.Errorf("%q %q: no error", code, s)
+			}
+		}
+	}
+	if !IsNum("1e5") || IsNum("1e400") {
+		t.Errorf("IsNum of finite and overflowing numbers")
+	}
+}
+
+// 文本单元格中的数字 常规格式, 文本格式和没有数字占位符的格式保持原样
+func TestReadCellText(t *testing.T) {
+	file := excelize.NewFile()
+	numFmt := func(id int) int {
+		style, err := file.NewStyle(&excelize.Style{NumFmt: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return style
+	}
+	customFmt := func(code string) int {
+		style, err := file.NewStyle(&excelize.Style{CustomNumFmt: &code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return style
+	}
+	tests := []struct {
+		text  string
+		style int
+		want  string
+	}{
+		{"00123", 0, "00123"},
+		{"00123", numFmt(49), "00123"},
+		{"110101199001011234", numFmt(49), "110101199001011234"},
+		{"110101199001011234", 0, "110101199001011234"},
+		{"Infinity", numFmt(49), "Infinity"},
+		{"NaN", 0, "NaN"},
+		{"Infinity", numFmt(2), "Infinity"},
+		{"1e5", customFmt("yyyy/m/d"), "1e5"},
+		{"12.5", customFmt(`0.00;-0.00;0;"text: "@`), "text: 12.5"},
+		{"12.5", numFmt(2), "12.5"},
+		{"12.00", numFmt(2), "12.00"},
+		{"12", customFmt("0.00;-0.00"), "12"},
+		{"abc", customFmt(`0;-0;0;"text: "@`), "text: abc"},
+		{"abc", customFmt(`"pre "@`), "pre abc"},
+		{"abc", customFmt(`0;-0;0;"hidden"`), "hidden"},
+	}
+	d := &Ex2Img{}
+	for i, tt := range tests {
+		axis, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := file.SetCellStr("Sheet1", axis, tt.text); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.SetCellStyle("Sheet1", axis, axis, tt.style); err != nil {
+			t.Fatal(err)
+		}
+		nt, cType, _ := d.readCell(file, "Sheet1", axis)
+		if cType != excelize.CellTypeString {
+			t.Errorf("%s: type %v", axis, cType)
+		}
+		if nt.text != tt.want {
+			t.Errorf("%q style %d: got %q, want %q", tt.text, tt.style, nt.text, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"strings"
+)
+
+// DefaultLocale 未设置 Ex2Img.Locale 时使用的区域
+const DefaultLocale = "zh-CN"
+
+// builtInNumFmts 内置的数字格式 工作簿中只保存编号, 格式代码由 Excel 按编号确定
+// 5-8, 41-44 的货币和 14, 22 的日期随区域变化, 这里是 en-US 的格式
+var builtInNumFmts = map[int]string{
+	0:  "General",
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	5:  `"$"#,##0_);\("$"#,##0\)`,
+	6:  `"$"#,##0_);[Red]\("$"#,##0\)`,
+	7:  `"$"#,##0.00_);\("$"#,##0.00\)`,
+	8:  `"$"#,##0.00_);[Red]\("$"#,##0.00\)`,
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00E+00",
+	12: "# ?/?",
+	13: "# ??/??",
+	14: "m/d/yyyy",
+	15: "d-mmm-yy",
+	16: "d-mmm",
+	17: "mmm-yy",
+	18: "h:mm AM/PM",
+	19: "h:mm:ss AM/PM",
+	20: "h:mm",
+	21: "h:mm:ss",
+	22: "m/d/yyyy h:mm",
+	37: "#,##0 ;(#,##0)",
+	38: "#,##0 ;[Red](#,##0)",
+	39: "#,##0.00;(#,##0.00)",
+	40: "#,##0.00;[Red](#,##0.00)",
+	41: `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
+	42: `_("$"* #,##0_);_("$"* \(#,##0\);_("$"* "-"_);_(@_)`,
+	43: `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
+	44: `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+	45: "mm:ss",
+	46: "[h]:mm:ss",
+	47: "mm:ss.0",
+	48: "##0.0E+0",
+	49: "@",
+}
+
+// localeNumFmts 各区域不同于 builtInNumFmts 的内置格式 包括中日韩的日期格式 27-36, 50-58
+var localeNumFmts = map[string]map[int]string{
+	"zh-cn": {
+		5:  `"¥"#,##0;"¥"\-#,##0`,
+		6:  `"¥"#,##0;[Red]"¥"\-#,##0`,
+		7:  `"¥"#,##0.00;"¥"\-#,##0.00`,
+		8:  `"¥"#,##0.00;[Red]"¥"\-#,##0.00`,
+		14: "yyyy/m/d",
+		22: "yyyy/m/d h:mm",
+		27: `yyyy"年"m"月"`,
+		28: `m"月"d"日"`,
+		29: `m"月"d"日"`,
+		30: "m-d-yy",
+		31: `yyyy"年"m"月"d"日"`,
+		32: `h"时"mm"分"`,
+		33: `h"时"mm"分"ss"秒"`,
+		34: `上午/下午h"时"mm"分"`,
+		35: `上午/下午h"时"mm"分"ss"秒"`,
+		36: `yyyy"年"m"月"`,
+		42: `_ "¥"* #,##0_ ;_ "¥"* \-#,##0_ ;_ "¥"* "-"_ ;_ @_ `,
+		44: `_ "¥"* #,##0.00_ ;_ "¥"* \-#,##0.00_ ;_ "¥"* "-"??_ ;_ @_ `,
+		50: `yyyy"年"m"月"`,
+		51: `m"月"d"日"`,
+		52: `yyyy"年"m"月"`,
+		53: `m"月"d"日"`,
+		54: `m"月"d"日"`,
+		55: `上午/下午h"时"mm"分"`,
+		56: `上午/下午h"时"mm"分"ss"秒"`,
+		57: `yyyy"年"m"月"`,
+		58: `m"月"d"日"`,
+	},
+	"zh-tw": {
+		5:  `"NT$"#,##0_);\("NT$"#,##0\)`,
+		6:  `"NT$"#,##0_);[Red]\("NT$"#,##0\)`,
+		7:  `"NT$"#,##0.00_);\("NT$"#,##0.00\)`,
+		8:  `"NT$"#,##0.00_);[Red]\("NT$"#,##0.00\)`,
+		14: "yyyy/m/d",
+		22: "yyyy/m/d h:mm",
+		27: `[$-404]e/m/d`,
+		28: `[$-404]e"年"m"月"d"日"`,
+		29: `[$-404]e"年"m"月"d"日"`,
+		30: "m/d/yy",
+		31: `yyyy"年"m"月"d"日"`,
+		32: `hh"時"mm"分"`,
+		33: `hh"時"mm"分"ss"秒"`,
+		34: `上午/下午hh"時"mm"分"`,
+		35: `上午/下午hh"時"mm"分"ss"秒"`,
+		36: `[$-404]e/m/d`,
+		50: `[$-404]e/m/d`,
+		51: `[$-404]e"年"m"月"d"日"`,
+		52: `上午/下午hh"時"mm"分"`,
+		53: `上午/下午hh"時"mm"分"ss"秒"`,
+		54: `[$-404]e"年"m"月"d"日"`,
+		55: `上午/下午hh"時"mm"分"`,
+		56: `上午/下午hh"時"mm"分"ss"秒"`,
+		57: `[$-404]e/m/d`,
+		58: `[$-404]e"年"m"月"d"日"`,
+	},
+	"ja-jp": {
+		5:  `"¥"#,##0;"¥"\-#,##0`,
+		6:  `"¥"#,##0;[Red]"¥"\-#,##0`,
+		7:  `"¥"#,##0.00;"¥"\-#,##0.00`,
+		8:  `"¥"#,##0.00;[Red]"¥"\-#,##0.00`,
+		14: "yyyy/m/d",
+		22: "yyyy/m/d h:mm",
+		27: `[$-411]ge.m.d`,
+		28: `[$-411]ggge"年"m"月"d"日"`,
+		29: `[$-411]ggge"年"m"月"d"日"`,
+		30: "m/d/yy",
+		31: `yyyy"年"m"月"d"日"`,
+		32: `h"時"mm"分"`,
+		33: `h"時"mm"分"ss"秒"`,
+		34: `yyyy"年"m"月"`,
+		35: `m"月"d"日"`,
+		36: `[$-411]ge.m.d`,
+		50: `[$-411]ge.m.d`,
+		51: `[$-411]ggge"年"m"月"d"日"`,
+		52: `yyyy"年"m"月"`,
+		53: `m"月"d"日"`,
+		54: `[$-411]ggge"年"m"月"d"日"`,
+		55: `yyyy"年"m"月"`,
+		56: `m"月"d"日"`,
+		57: `[$-411]ge.m.d`,
+		58: `[$-411]ggge"年"m"月"d"日"`,
+	},
+	"ko-kr": {
+		5:  `"₩"#,##0;"₩"\-#,##0`,
+		6:  `"₩"#,##0;[Red]"₩"\-#,##0`,
+		7:  `"₩"#,##0.00;"₩"\-#,##0.00`,
+		8:  `"₩"#,##0.00;[Red]"₩"\-#,##0.00`,
+		14: "yyyy-mm-dd",
+		22: "yyyy-mm-dd h:mm",
+		27: `yyyy"年" mm"月" dd"日"`,
+		28: "mm-dd",
+		29: "mm-dd",
+		30: "mm-dd-yy",
+		31: `yyyy"년" mm"월" dd"일"`,
+		32: `h"시" mm"분"`,
+		33: `h"시" mm"분" ss"초"`,
+		34: "yyyy-mm-dd",
+		35: "yyyy-mm-dd",
+		36: `yyyy"年" mm"月" dd"日"`,
+		50: `yyyy"年" mm"月" dd"日"`,
+		51: "mm-dd",
+		52: "yyyy-mm-dd",
+		53: "yyyy-mm-dd",
+		54: "mm-dd",
+		55: "yyyy-mm-dd",
+		56: "yyyy-mm-dd",
+		57: `yyyy"年" mm"月" dd"日"`,
+		58: "mm-dd",
+	},
+}
+
+// builtInNumFmt 区域 locale 中编号 id 的内置格式代码
+// 区域没有定义的编号使用 en-US 的格式, 都没有时 ok 为false
+func builtInNumFmt(id int, locale string) (code string, ok bool) {
+	if code, ok = localeNumFmts[strings.ToLower(locale)][id]; ok {
+		return code, true
+	}
+	code, ok = builtInNumFmts[id]
+	return
+}
+
+// getLocale 内置格式使用的区域
+func (d *Ex2Img) getLocale() string {
+	if d.Locale != "" {
+		return d.Locale
+	}
+	return DefaultLocale
+}
+
+// numFmtCode 样式的数字格式代码 自定义格式优先, 其次为内置格式
+func (d *Ex2Img) numFmtCode(file *excelize.File, numFmtID int) (string, bool) {
+	if file.Styles.NumFmts != nil {
+		for _, numFmt := range file.Styles.NumFmts.NumFmt {
+			if numFmt.NumFmtID == numFmtID {
+				return numFmt.FormatCode, true
+			}
+		}
+	}
+	return builtInNumFmt(numFmtID, d.getLocale())
+}
@@ -0,0 +1,205 @@
+package lib
+
+import (
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"image"
+	"sort"
+	"strings"
+)
+
+// DrawPages 按打印区域和手动分页符分页转换 每页一张图片
+// 打印区域取 Range, 未设置时取 _xlnm.Print_Area, 都没有时为已使用区域
+// _xlnm.Print_Titles 中的标题行列会重复出现在之后的每一页
+func (d *Ex2Img) DrawPages(file *excelize.File) ([]*image.RGBA, error) {
+	sheet, err := d.resolveSheet(file)
+	if err != nil {
+		return nil, err
+	}
+	grids, err := d.pageGrids(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]*image.RGBA, 0, len(grids))
+	for i, g := range grids {
+		rgba, err := d.drawGrid(file, g)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+		pages = append(pages, rgba)
+	}
+	return pages, nil
+}
+
+// DrawPagesToPngFile 分页转换 每页存储一张PNG图片 文件名为 {base}_{页码}.png
+func (d *Ex2Img) DrawPagesToPngFile(file *excelize.File, base string) ([]string, error) {
+	pages, err := d.DrawPages(file)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]string, 0, len(pages))
+	for i, page := range pages {
+		output := fmt.Sprintf("%s_%d.png", base, i+1)
+		if err := d.save(output, page); err != nil {
+			return outputs, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// DrawPagesToPdfFile 分页转换 存储为多页PDF
+func (d *Ex2Img) DrawPagesToPdfFile(file *excelize.File, outPdfName string) error {
+	pages, err := d.DrawPages(file)
+	if err != nil {
+		return err
+	}
+	return d.savePdf(outPdfName, pages)
+}
+
+// pageGrids 计算每一页要绘制的行列
+func (d *Ex2Img) pageGrids(file *excelize.File, sheet string) ([]*Grid, error) {
+	areas, err := d.printAreas(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	titleRows, titleCols, err := printTitles(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := readWorksheet(file, sheet)
+	if err != nil {
+		return nil, err
+	}
+	rowBreaks, colBreaks, pageSetUp := ws.RowBreaks, ws.ColBreaks, ws.PageSetUp
+	grids := make([]*Grid, 0)
+	for _, area := range areas {
+		if area.EndRow < area.StartRow || area.EndCol < area.StartCol {
+			continue
+		}
+		rowBands := splitBands(area.StartRow, area.EndRow, rowBreaks)
+		colBands := splitBands(area.StartCol, area.EndCol, colBreaks)
+		addPage := func(rows, cols []int) {
+			grids = append(grids, &Grid{
+				Sheet: sheet,
+				Rows:  append(titlesBefore(titleRows, rows[0]), rows...),
+				Cols:  append(titlesBefore(titleCols, cols[0]), cols...),
+			})
+		}
+		// 默认先列后行(downThenOver)
+		if pageSetUp.PageOrder == "overThenDown" {
+			for _, rows := range rowBands {
+				for _, cols := range colBands {
+					addPage(rows, cols)
+				}
+			}
+			continue
+		}
+		for _, cols := range colBands {
+			for _, rows := range rowBands {
+				addPage(rows, cols)
+			}
+		}
+	}
+	if len(grids) == 0 {
+		return nil, fmt.Errorf("sheet %s has no data", sheet)
+	}
+	return grids, nil
+}
+
+// printAreas 打印区域 可以有多个不连续区域 每个区域单独分页
+func (d *Ex2Img) printAreas(file *excelize.File, sheet string) ([]*CellRange, error) {
+	if d.Range != "" {
+		rg, err := d.resolveRange(file, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return []*CellRange{rg}, nil
+	}
+	dn, ok := findDefinedName(file, "_xlnm.Print_Area", sheet)
+	if !ok {
+		return []*CellRange{usedRange(file, sheet)}, nil
+	}
+	areas := make([]*CellRange, 0)
+	for _, ref := range splitRefs(dn.RefersTo) {
+		rg, err := ParseRange(ref)
+		if err != nil {
+			return nil, fmt.Errorf("invalid print area: %v", err)
+		}
+		rg.Sheet = sheet
+		d.clampRange(file, rg)
+		areas = append(areas, rg)
+	}
+	return areas, nil
+}
+
+// printTitles 打印标题 整行引用为标题行, 整列引用为标题列
+func printTitles(file *excelize.File, sheet string) (rows, cols []int, err error) {
+	dn, ok := findDefinedName(file, "_xlnm.Print_Titles", sheet)
+	if !ok {
+		return
+	}
+	for _, ref := range splitRefs(dn.RefersTo) {
+		rg, err := ParseRange(ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid print titles: %v", err)
+		}
+		if rg.StartCol == 1 && rg.EndCol == excelize.TotalColumns {
+			for i := rg.StartRow; i <= rg.EndRow; i++ {
+				rows = append(rows, i)
+			}
+		} else if rg.StartRow == 1 && rg.EndRow == excelize.TotalRows {
+			for i := rg.StartCol; i <= rg.EndCol; i++ {
+				cols = append(cols, i)
+			}
+		}
+	}
+	return
+}
+
+// splitRefs 按逗号拆分多个引用 忽略引号中的逗号
+func splitRefs(refersTo string) []string {
+	refs := make([]string, 0)
+	quoted, start := false, 0
+	refersTo = strings.TrimPrefix(refersTo, "=")
+	for i, r := range refersTo {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			refs = append(refs, refersTo[start:i])
+			start = i + 1
+		}
+	}
+	return append(refs, refersTo[start:])
+}
+
+// splitBands 按分页符将 [s, e] 分段 分页符 id 为一页的最后一行或列
+func splitBands(s, e int, breaks xlsxBreaks) [][]int {
+	ids := make([]int, 0, len(breaks.Brk))
+	for _, brk := range breaks.Brk {
+		ids = append(ids, brk.ID)
+	}
+	sort.Ints(ids)
+	bands := make([][]int, 0)
+	band := make([]int, 0)
+	for i := s; i <= e; i++ {
+		band = append(band, i)
+		if j := sort.SearchInts(ids, i); j < len(ids) && ids[j] == i && i < e {
+			bands = append(bands, band)
+			band = make([]int, 0)
+		}
+	}
+	return append(bands, band)
+}
+
+// titlesBefore 本页开始之前的标题行或列 标题已在本页中时不重复
+func titlesBefore(titles []int, first int) []int {
+	before := make([]int, 0, len(titles))
+	for _, t := range titles {
+		if t < first {
+			before = append(before, t)
+		}
+	}
+	return before
+}
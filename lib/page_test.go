@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"image"
+	"testing"
+)
+
+// 默认列宽96像素, 默认行高30像素, 右侧和底部多1像素的边框
+func pageSize(rows, cols int) image.Point {
+	return image.Pt(96*cols+1, 30*rows+1)
+}
+
+// fillSheet 在 Sheet1 的 A1:D6 中填入数据
+func fillSheet(t *testing.T, f *excelize.File) {
+	t.Helper()
+	for r := 1; r <= 6; r++ {
+		for c := 1; c <= 4; c++ {
+			axis, _ := excelize.CoordinatesToCellName(c, r)
+			if err := f.SetCellValue("Sheet1", axis, axis); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestDrawPages(t *testing.T) {
+	// 第3行和B列之后分页, 第1行和A列为打印标题
+	titles := &excelize.DefinedName{Name: "_xlnm.Print_Titles", RefersTo: "Sheet1!$A:$A,Sheet1!$1:$1", Scope: "Sheet1"}
+	tests := []struct {
+		name  string
+		file  func(t *testing.T) *excelize.File
+		pages []image.Point
+	}{
+		{
+			name: "breaks in memory",
+			file: func(t *testing.T) *excelize.File {
+				f := excelize.NewFile()
+				fillSheet(t, f)
+				if err := f.InsertPageBreak("Sheet1", "C4"); err != nil {
+					t.Fatal(err)
+				}
+				return f
+			},
+			pages: []image.Point{pageSize(3, 2), pageSize(4, 2), pageSize(3, 3), pageSize(4, 3)},
+		},
+		{
+			name: "over then down",
+			file: func(t *testing.T) *excelize.File {
+				f := openSheetXML(t, `<sheetData/><rowBreaks><brk id="3" man="1"/></rowBreaks><colBreaks><brk id="2" man="1"/></colBreaks><pageSetup pageOrder="overThenDown"/>`)
+				fillSheet(t, f)
+				return f
+			},
+			pages: []image.Point{pageSize(3, 2), pageSize(3, 3), pageSize(4, 2), pageSize(4, 3)},
+		},
+		{
+			name: "print area",
+			file: func(t *testing.T) *excelize.File {
+				f := excelize.NewFile()
+				fillSheet(t, f)
+				if err := f.InsertPageBreak("Sheet1", "A5"); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.SetDefinedName(&excelize.DefinedName{Name: "_xlnm.Print_Area", RefersTo: "Sheet1!$B$2:$C$6", Scope: "Sheet1"}); err != nil {
+					t.Fatal(err)
+				}
+				return f
+			},
+			// 第2到4行一页, 第5到6行加标题行一页, 每页加标题列
+			pages: []image.Point{pageSize(4, 3), pageSize(3, 3)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.file(t)
+			if err := f.SetDefinedName(titles); err != nil {
+				t.Fatal(err)
+			}
+			pages, err := (&Ex2Img{Fonts: testFonts(t)}).DrawPages(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != len(tt.pages) {
+				t.Fatalf("got %d pages, want %d", len(pages), len(tt.pages))
+			}
+			for i, page := range pages {
+				if got := page.Bounds().Size(); got != tt.pages[i] {
+					t.Errorf("page %d size %v, want %v", i+1, got, tt.pages[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitBands(t *testing.T) {
+	brk := func(ids ...int) xlsxBreaks {
+		var b xlsxBreaks
+		for _, id := range ids {
+			b.Brk = append(b.Brk, struct {
+				ID int `xml:"id,attr"`
+			}{id})
+		}
+		return b
+	}
+	tests := []struct {
+		name   string
+		s, e   int
+		breaks xlsxBreaks
+		want   [][]int
+	}{
+		{"no breaks", 1, 3, brk(), [][]int{{1, 2, 3}}},
+		{"unsorted", 1, 6, brk(4, 2), [][]int{{1, 2}, {3, 4}, {5, 6}}},
+		{"outside", 3, 5, brk(1, 8), [][]int{{3, 4, 5}}},
+		{"at the end", 1, 3, brk(3), [][]int{{1, 2, 3}}},
+	}
+	for _, tt := range tests {
+		got := splitBands(tt.s, tt.e, tt.breaks)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if len(got[i]) != len(tt.want[i]) || got[i][0] != tt.want[i][0] || got[i][len(got[i])-1] != tt.want[i][len(tt.want[i])-1] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+// pdfWriter 极简PDF输出 每张图片一页
+type pdfWriter struct {
+	w       io.Writer
+	offset  int
+	offsets []int
+}
+
+func (p *pdfWriter) write(format string, a ...interface{}) {
+	n, _ := fmt.Fprintf(p.w, format, a...)
+	p.offset += n
+}
+
+// object 写入一个对象 返回对象号
+func (p *pdfWriter) object(dict string, stream []byte) int {
+	p.offsets = append(p.offsets, p.offset)
+	id := len(p.offsets)
+	p.write("%d 0 obj\n%s\n", id, dict)
+	if stream != nil {
+		p.write("stream\n")
+		n, _ := p.w.Write(stream)
+		p.offset += n
+		p.write("\nendstream\n")
+	}
+	p.write("endobj\n")
+	return id
+}
+
+// writePdf 将图片按顺序写成多页PDF
+func writePdf(w io.Writer, pages []*image.RGBA) error {
+	p := &pdfWriter{w: w}
+	p.write("%%PDF-1.4\n")
+	// 1: Catalog 2: Pages 预留
+	p.offsets = append(p.offsets, 0, 0)
+	kids := ""
+	for _, img := range pages {
+		b := img.Bounds()
+		var raw bytes.Buffer
+		zw := zlib.NewWriter(&raw)
+		row := make([]byte, 0, b.Dx()*3)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row = row[:0]
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := img.PixOffset(x, y)
+				row = append(row, img.Pix[i], img.Pix[i+1], img.Pix[i+2])
+			}
+			if _, err := zw.Write(row); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		imgID := p.object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			b.Dx(), b.Dy(), raw.Len()), raw.Bytes())
+		// 按绘制DPI换算为PDF的点
+		pw, ph := float64(b.Dx())*72/renderDPI, float64(b.Dy())*72/renderDPI
+		content := []byte(fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", pw, ph))
+		contentID := p.object(fmt.Sprintf("<< /Length %d >>", len(content)), content)
+		pageID := p.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pw, ph, imgID, contentID), nil)
+		kids += fmt.Sprintf("%d 0 R ", pageID)
+	}
+	p.offsets[0] = p.offset
+	p.write("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	p.offsets[1] = p.offset
+	p.write("2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", kids, len(pages))
+	xref := p.offset
+	p.write("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, off := range p.offsets {
+		p.write("%010d 00000 n \n", off)
+	}
+	p.write("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, xref)
+	return nil
+}
+
+func (d *Ex2Img) savePdf(filename string, pages []*image.RGBA) error {
+	outFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	b := bufio.NewWriter(outFile)
+	err = writePdf(b, pages)
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
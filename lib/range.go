@@ -0,0 +1,180 @@
+package lib
+
+import (
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CellRange 单元格区域 行列均从1开始且包含边界
+type CellRange struct {
+	Sheet    string
+	StartCol int
+	StartRow int
+	EndCol   int
+	EndRow   int
+}
+
+// Grid 实际绘制的行和列 升序排列 可以不连续(如打印标题加分页)
+type Grid struct {
+	Sheet string
+	Rows  []int
+	Cols  []int
+}
+
+// Grid 区域内的全部行列
+func (r *CellRange) Grid() *Grid {
+	g := &Grid{
+		Sheet: r.Sheet,
+		Rows:  make([]int, 0, r.EndRow-r.StartRow+1),
+		Cols:  make([]int, 0, r.EndCol-r.StartCol+1),
+	}
+	for i := r.StartRow; i <= r.EndRow; i++ {
+		g.Rows = append(g.Rows, i)
+	}
+	for i := r.StartCol; i <= r.EndCol; i++ {
+		g.Cols = append(g.Cols, i)
+	}
+	return g
+}
+
+// gridIndexSpan 在升序的 idx 中查找 [s, e] 内第一个和最后一个行或列的下标
+func gridIndexSpan(idx []int, s, e int) (first, last int, ok bool) {
+	first = sort.SearchInts(idx, s)
+	last = sort.SearchInts(idx, e+1) - 1
+	return first, last, first <= last
+}
+
+// resolveRange 解析 Range 得到工作表和单元格区域, Range 未指定工作表时使用 sheet
+func (d *Ex2Img) resolveRange(file *excelize.File, sheet string) (*CellRange, error) {
+	ref := strings.TrimPrefix(strings.TrimSpace(d.Range), "=")
+	if dn, ok := findDefinedName(file, ref, sheet); ok {
+		ref = strings.TrimPrefix(dn.RefersTo, "=")
+	}
+	rg, err := ParseRange(ref)
+	if err != nil {
+		return nil, err
+	}
+	if rg.Sheet == "" {
+		rg.Sheet = sheet
+	}
+	for _, name := range file.GetSheetList() {
+		if strings.EqualFold(name, rg.Sheet) {
+			rg.Sheet = name
+			d.clampRange(file, rg)
+			return rg, nil
+		}
+	}
+	return nil, fmt.Errorf("sheet %s does not exist", rg.Sheet)
+}
+
+// clampRange 整行或整列引用(如 A:C, 3:10)限制到已使用区域
+func (d *Ex2Img) clampRange(file *excelize.File, rg *CellRange) {
+	if rg.EndRow < excelize.TotalRows && rg.EndCol < excelize.TotalColumns {
+		return
+	}
+	used := usedRange(file, rg.Sheet)
+	if rg.EndRow >= excelize.TotalRows {
+		rg.EndRow = maxInt(used.EndRow, rg.StartRow)
+	}
+	if rg.EndCol >= excelize.TotalColumns {
+		rg.EndCol = maxInt(used.EndCol, rg.StartCol)
+	}
+}
+
+// usedRange 工作表数据所占的区域
+func usedRange(file *excelize.File, sheet string) *CellRange {
+	rg := &CellRange{Sheet: sheet, StartCol: 1, StartRow: 1}
+	data, err := file.GetRows(sheet)
+	if err != nil {
+		return rg
+	}
+	rg.EndRow = len(data)
+	for _, datum := range data {
+		if len(datum) > rg.EndCol {
+			rg.EndCol = len(datum)
+		}
+	}
+	return rg
+}
+
+// findDefinedName 查找名称 工作表级名称优先于工作簿级名称
+func findDefinedName(file *excelize.File, name, sheet string) (excelize.DefinedName, bool) {
+	var (
+		found excelize.DefinedName
+		ok    bool
+	)
+	for _, dn := range file.GetDefinedName() {
+		if !strings.EqualFold(dn.Name, name) {
+			continue
+		}
+		if dn.Scope == sheet {
+			return dn, true
+		}
+		if dn.Scope == "Workbook" {
+			found, ok = dn, true
+		}
+	}
+	return found, ok
+}
+
+// ParseRange 解析A1格式的区域 如 B3:H40, Sheet1!B3:H40, 'My Sheet'!$B$3:$H$40, A:C, 3:10
+func ParseRange(ref string) (*CellRange, error) {
+	rg := &CellRange{}
+	ref = strings.TrimSpace(ref)
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		sheet := ref[:i]
+		if strings.HasPrefix(sheet, "'") && strings.HasSuffix(sheet, "'") && len(sheet) > 1 {
+			sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+		}
+		rg.Sheet = sheet
+		ref = ref[i+1:]
+	}
+	if ref == "" || strings.Contains(ref, ",") {
+		return nil, fmt.Errorf("invalid range %q", ref)
+	}
+	parts := strings.Split(strings.ReplaceAll(ref, "$", ""), ":")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid range %q", ref)
+	}
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	var err error
+	if rg.StartCol, rg.StartRow, err = parseRangePoint(parts[0]); err != nil {
+		return nil, fmt.Errorf("invalid range %q: %v", ref, err)
+	}
+	if rg.EndCol, rg.EndRow, err = parseRangePoint(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid range %q: %v", ref, err)
+	}
+	// 整行 或 整列
+	if rg.StartCol == 0 || rg.EndCol == 0 {
+		rg.StartCol, rg.EndCol = 1, excelize.TotalColumns
+	}
+	if rg.StartRow == 0 || rg.EndRow == 0 {
+		rg.StartRow, rg.EndRow = 1, excelize.TotalRows
+	}
+	if rg.StartCol > rg.EndCol {
+		rg.StartCol, rg.EndCol = rg.EndCol, rg.StartCol
+	}
+	if rg.StartRow > rg.EndRow {
+		rg.StartRow, rg.EndRow = rg.EndRow, rg.StartRow
+	}
+	return rg, nil
+}
+
+// parseRangePoint 解析区域的一端, 只有列名或行号时另一项返回0
+func parseRangePoint(s string) (col, row int, err error) {
+	if row, err = strconv.Atoi(s); err == nil {
+		if row < 1 || row > excelize.TotalRows {
+			return 0, 0, fmt.Errorf("invalid row number %q", s)
+		}
+		return 0, row, nil
+	}
+	if col, err = excelize.ColumnNameToNumber(s); err == nil {
+		return col, 0, nil
+	}
+	return excelize.CellNameToCoordinates(s)
+}
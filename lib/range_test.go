@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"github.com/xuri/excelize/v2"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want CellRange
+		err  bool
+	}{
+		{ref: "B3:H40", want: CellRange{StartCol: 2, StartRow: 3, EndCol: 8, EndRow: 40}},
+		{ref: " Sheet1!B3:H40 ", want: CellRange{Sheet: "Sheet1", StartCol: 2, StartRow: 3, EndCol: 8, EndRow: 40}},
+		{ref: "'My Sheet'!$B$3:$H$40", want: CellRange{Sheet: "My Sheet", StartCol: 2, StartRow: 3, EndCol: 8, EndRow: 40}},
+		{ref: "'It''s'!A1", want: CellRange{Sheet: "It's", StartCol: 1, StartRow: 1, EndCol: 1, EndRow: 1}},
+		{ref: "B2", want: CellRange{StartCol: 2, StartRow: 2, EndCol: 2, EndRow: 2}},
+		{ref: "H40:B3", want: CellRange{StartCol: 2, StartRow: 3, EndCol: 8, EndRow: 40}},
+		{ref: "C1:A3", want: CellRange{StartCol: 1, StartRow: 1, EndCol: 3, EndRow: 3}},
+		{ref: "A:C", want: CellRange{StartCol: 1, StartRow: 1, EndCol: 3, EndRow: excelize.TotalRows}},
+		{ref: "C:A", want: CellRange{StartCol: 1, StartRow: 1, EndCol: 3, EndRow: excelize.TotalRows}},
+		{ref: "3:10", want: CellRange{StartCol: 1, StartRow: 3, EndCol: excelize.TotalColumns, EndRow: 10}},
+		{ref: "XFD1048576", want: CellRange{StartCol: excelize.TotalColumns, StartRow: excelize.TotalRows, EndCol: excelize.TotalColumns, EndRow: excelize.TotalRows}},
+		{ref: "", err: true},
+		{ref: "Sheet1!", err: true},
+		{ref: "A1,B2", err: true},
+		{ref: "A1:B2:C3", err: true},
+		{ref: "A0", err: true},
+		{ref: "0:3", err: true},
+		{ref: "1048577", err: true},
+		{ref: "XFE1", err: true},
+		{ref: "A1:B1048577", err: true},
+		{ref: "A1:?", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.ref)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: got %+v, want error", tt.ref, *got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.ref, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.ref, *got, tt.want)
+		}
+	}
+}
+
+// rangeFile Sheet1 的数据在 A1:C4, Other 的数据在 A1:B2, 工作簿级和 Other 的工作表级名称 Area, 只有 Other 的名称 Local
+func rangeFile(t *testing.T) *excelize.File {
+	t.Helper()
+	file := excelize.NewFile()
+	file.NewSheet("Other")
+	file.NewSheet("Empty")
+	for _, err := range []error{
+		file.SetCellValue("Sheet1", "C4", 1),
+		file.SetCellValue("Other", "B2", 1),
+		file.SetDefinedName(&excelize.DefinedName{Name: "Area", RefersTo: "Sheet1!$A$1:$B$2", Scope: "Workbook"}),
+		file.SetDefinedName(&excelize.DefinedName{Name: "Area", RefersTo: "Other!$B$2:$C$3", Scope: "Other"}),
+		file.SetDefinedName(&excelize.DefinedName{Name: "Local", RefersTo: "Other!$A$1", Scope: "Other"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+func TestResolveRange(t *testing.T) {
+	file := rangeFile(t)
+	tests := []struct {
+		name  string
+		rng   string
+		sheet string
+		want  CellRange
+		err   string
+	}{
+		{"range on the current sheet", "A1:B2", "Sheet1", CellRange{"Sheet1", 1, 1, 2, 2}, ""},
+		{"sheet name ignores case", "other!A1:B2", "Sheet1", CellRange{"Other", 1, 1, 2, 2}, ""},
+		{"missing sheet", "Missing!A1", "Sheet1", CellRange{}, "sheet Missing does not exist"},
+		{"invalid range", "A1:B0", "Sheet1", CellRange{}, "invalid range"},
+		{"out of the used range", "B2:Z100", "Sheet1", CellRange{"Sheet1", 2, 2, 26, 100}, ""},
+		{"whole columns clamped to used rows", "A:B", "Sheet1", CellRange{"Sheet1", 1, 1, 2, 4}, ""},
+		{"whole rows clamped to used columns", "$2:$3", "Sheet1", CellRange{"Sheet1", 1, 2, 3, 3}, ""},
+		{"whole rows beyond the used range", "6:8", "Sheet1", CellRange{"Sheet1", 1, 6, 3, 8}, ""},
+		{"whole columns on an empty sheet", "B:C", "Empty", CellRange{"Empty", 2, 1, 3, 1}, ""},
+		{"workbook name", "=Area", "Sheet1", CellRange{"Sheet1", 1, 1, 2, 2}, ""},
+		{"sheet name overrides workbook name", "area", "Other", CellRange{"Other", 2, 2, 3, 3}, ""},
+		{"sheet name of another sheet", "Local", "Sheet1", CellRange{}, "invalid range"},
+		{"sheet name", "Local", "Other", CellRange{"Other", 1, 1, 1, 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Ex2Img{Range: tt.rng}).resolveRange(file, tt.sheet)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got %+v, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindDefinedName(t *testing.T) {
+	file := rangeFile(t)
+	tests := []struct {
+		name, sheet string
+		refersTo    string
+	}{
+		{"Area", "Sheet1", "Sheet1!$A$1:$B$2"},
+		{"AREA", "Other", "Other!$B$2:$C$3"},
+		{"Area", "Empty", "Sheet1!$A$1:$B$2"},
+		{"Local", "Other", "Other!$A$1"},
+		{"Local", "Sheet1", ""},
+		{"Missing", "Sheet1", ""},
+	}
+	for _, tt := range tests {
+		dn, ok := findDefinedName(file, tt.name, tt.sheet)
+		if ok != (tt.refersTo != "") || dn.RefersTo != tt.refersTo {
+			t.Errorf("%s on %s: got %q %v, want %q", tt.name, tt.sheet, dn.RefersTo, ok, tt.refersTo)
+		}
+	}
+}
+
+func TestClampRange(t *testing.T) {
+	file := rangeFile(t)
+	tests := []struct {
+		rg   CellRange
+		want CellRange
+	}{
+		{CellRange{"Sheet1", 2, 2, 5, 9}, CellRange{"Sheet1", 2, 2, 5, 9}},
+		{CellRange{"Sheet1", 1, 1, excelize.TotalColumns, excelize.TotalRows}, CellRange{"Sheet1", 1, 1, 3, 4}},
+		{CellRange{"Sheet1", 5, 1, excelize.TotalColumns, 2}, CellRange{"Sheet1", 5, 1, 5, 2}},
+		{CellRange{"Other", 1, 3, 1, excelize.TotalRows}, CellRange{"Other", 1, 3, 1, 3}},
+	}
+	for _, tt := range tests {
+		rg := tt.rg
+		(&Ex2Img{}).clampRange(file, &rg)
+		if rg != tt.want {
+			t.Errorf("clamp %+v: got %+v, want %+v", tt.rg, rg, tt.want)
+		}
+	}
+}
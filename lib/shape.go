@@ -0,0 +1,447 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-text/typesetting/di"
+	otfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/shaping"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/unicode/bidi"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 阿拉伯文, 希伯来文, 泰文, 印度诸文字等复杂文字 freetype 逐字绘制时字形不会随上下文变化
+// 这些文字使用 go-text 的 HarfBuzz 移植塑形, 并按双向文字算法排列从右到左的文字
+
+// complexScripts 需要塑形的文字 字形随上下文变化, 需要重新排列组合或有组合附加符号
+var complexScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko,
+	unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati, unicode.Oriya, unicode.Tamil,
+	unicode.Telugu, unicode.Kannada, unicode.Malayalam, unicode.Sinhala,
+	unicode.Thai, unicode.Lao, unicode.Tibetan, unicode.Myanmar, unicode.Khmer, unicode.Mn,
+}
+
+// fontSource 从文件加载的字体的数据 第一次塑形或绘制彩色字形时才解析
+type fontSource struct {
+	data  []byte
+	index int
+	// color 有彩色字形 CBDT sbix 或 COLR 表
+	color bool
+	// bitmap 只有位图字形 没有 freetype 能读取的轮廓(glyf 表)
+	bitmap bool
+	once   sync.Once
+	font   *otfont.Font
+	colr   *colrTable
+}
+
+func (r *FontRegistry) addSource(ft *truetype.Font, buf []byte, index, offset int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	src := &fontSource{data: buf, index: index}
+	for _, tag := range []string{"CBDT", "sbix", "COLR"} {
+		src.color = src.color || sfntTable(buf, offset, tag) != nil
+	}
+	src.bitmap = src.color && sfntTable(buf, offset, "glyf") == nil
+	r.sources[ft] = src
+}
+
+func (r *FontRegistry) source(ft *truetype.Font) *fontSource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sources[ft]
+}
+
+func (src *fontSource) parse() {
+	src.once.Do(func() {
+		faces, err := otfont.ParseTTC(bytes.NewReader(src.data))
+		if err == nil && src.index < len(faces) {
+			src.font = faces[src.index].Font
+		}
+		if offsets, err := collectionOffsets(src.data); err == nil && src.index < len(offsets) {
+			src.colr = parseColr(sfntTable(src.data, offsets[src.index], "COLR"), sfntTable(src.data, offsets[src.index], "CPAL"))
+		}
+	})
+}
+
+// shapingFont 字体 ft 用于塑形的字体 不是从文件加载的或无法解析时返回nil
+func (r *FontRegistry) shapingFont(ft *truetype.Font) *otfont.Font {
+	src := r.source(ft)
+	if src == nil {
+		return nil
+	}
+	src.parse()
+	return src.font
+}
+
+// cellShaper 单元格的塑形状态 go-text 的 Face 和 Shaper 不能并发使用, 每个单元格单独创建
+type cellShaper struct {
+	shaper    shaping.HarfbuzzShaper
+	segmenter shaping.Segmenter
+	faces     map[*truetype.Font]*otfont.Face
+	lines     map[string]*shapedLine
+}
+
+// shapedLine 塑形后的一行文本
+type shapedLine struct {
+	// runs 按视觉顺序从左到右
+	runs  []shapedRun
+	width int
+}
+
+// shapedRun 塑形后字体, 方向和文字种类相同的一段文本
+type shapedRun struct {
+	out  shaping.Output
+	font Font
+	// ft 绘制使用的字体
+	ft *truetype.Font
+	// bold 模拟粗体加粗的像素 italic 模拟斜体
+	bold   int
+	italic bool
+	// level 双向文字算法的嵌入层级 奇数为从右到左
+	level int
+}
+
+// runFontmap 按后备字体为每个字符选择塑形使用的字体
+type runFontmap struct {
+	c     *ICell
+	face  *fallbackFace
+	first *otfont.Face
+	// glyphs 塑形字体对应的绘制字体
+	glyphs map[*otfont.Face]glyphFace
+	// emoji 后面有表情变体选择符(U+FE0F) 以彩色表情显示的字符
+	emoji map[rune]bool
+}
+
+func (m *runFontmap) ResolveFace(r rune) *otfont.Face {
+	gf := m.face.glyphForPresentation(r, isEmoji(r) || m.emoji[r])
+	if face := m.c.shapingFace(gf.ft); face != nil {
+		m.glyphs[face] = gf
+		return face
+	}
+	return m.first
+}
+
+func needsShaping(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, complexScripts...) || isRTL(r) || unicode.Is(emojiSequence, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// emojiVariants 后面有表情变体选择符的字符
+func emojiVariants(text []rune) map[rune]bool {
+	m := map[rune]bool{}
+	for i := 1; i < len(text); i++ {
+		if text[i] == 0xfe0f {
+			m[text[i-1]] = true
+		}
+	}
+	return m
+}
+
+// isRTL 字符是否为从右到左的强方向字符
+func isRTL(r rune) bool {
+	p, _ := bidi.LookupRune(r)
+	return p.Class() == bidi.R || p.Class() == bidi.AL
+}
+
+// isRTL 段落方向是否为从右到左 按文字方向设置, 根据内容时按第一个强方向字符
+func (c *ICell) isRTL() bool {
+	switch c.Style.Alignment.ReadingOrder {
+	case 1:
+		return false
+	case 2:
+		return true
+	}
+	for _, r := range c.Value {
+		p, _ := bidi.LookupRune(r)
+		switch p.Class() {
+		case bidi.L:
+			return false
+		case bidi.R, bidi.AL:
+			return true
+		}
+	}
+	return false
+}
+
+// shapingFace 字体 ft 用于塑形的 Face 无法塑形时返回nil
+func (c *ICell) shapingFace(ft *truetype.Font) *otfont.Face {
+	face, ok := c.shaping().faces[ft]
+	if !ok {
+		if f := c.fonts.shapingFont(ft); f != nil {
+			face = otfont.NewFace(f)
+		}
+		c.shaping().faces[ft] = face
+	}
+	return face
+}
+
+func (c *ICell) shaping() *cellShaper {
+	if c.shaper == nil {
+		c.shaper = &cellShaper{
+			faces: map[*truetype.Font]*otfont.Face{},
+			lines: map[string]*shapedLine{},
+		}
+	}
+	return c.shaper
+}
+
+// shapeLine 塑形一行文本 不需要塑形或首选字体无法塑形时返回nil, 按 freetype 逐字绘制
+func (c *ICell) shapeLine(line textLine) *shapedLine {
+	text := line.String()
+	if !needsShaping(text) {
+		return nil
+	}
+	key := lineKey(line)
+	if sl, ok := c.shaping().lines[key]; ok {
+		return sl
+	}
+	sl := c.layoutShaped(line, []rune(text))
+	c.shaping().lines[key] = sl
+	return sl
+}
+
+func (c *ICell) layoutShaped(line textLine, text []rune) *shapedLine {
+	levels := bidiLevels(text, c.isRTL())
+	cs := c.shaping()
+	runs := make([]shapedRun, 0, len(line))
+	start := 0
+	for _, r := range line {
+		n := utf8.RuneCountInString(r.Text)
+		if n == 0 {
+			continue
+		}
+		face := c.getRunFace(r.Font).(*fallbackFace)
+		fm := &runFontmap{c: c, face: face, first: c.shapingFace(face.faces[0].ft), glyphs: map[*otfont.Face]glyphFace{}, emoji: emojiVariants(text)}
+		if fm.first == nil {
+			return nil
+		}
+		fm.glyphs[fm.first] = face.faces[0]
+		size := fixed.Int26_6(math.Round(c.getRunSize(r.Font) * renderDPI / 72 * 64))
+		// 格式相同的一段按嵌入层级再分段 每段方向相同
+		for s := start; s < start+n; {
+			e := s + 1
+			for e < start+n && levels[e] == levels[s] {
+				e++
+			}
+			dir := di.DirectionLTR
+			if levels[s]%2 == 1 {
+				dir = di.DirectionRTL
+			}
+			input := shaping.Input{Text: text, RunStart: s, RunEnd: e, Direction: dir, Face: fm.first, Size: size}
+			for _, in := range cs.segmenter.Split(input, fm) {
+				gf := fm.glyphs[in.Face]
+				run := shapedRun{out: cs.shaper.Shape(in), font: r.Font, ft: gf.ft, level: levels[s]}
+				if sf, ok := gf.face.(*syntheticFace); ok {
+					run.bold, run.italic = sf.bold, sf.italic
+				}
+				runs = append(runs, run)
+			}
+			s = e
+		}
+		start += n
+	}
+	sl := &shapedLine{runs: reorderRuns(runs)}
+	w := fixed.Int26_6(0)
+	for _, run := range sl.runs {
+		w += run.out.Advance
+	}
+	sl.width = w.Ceil()
+	return sl
+}
+
+// bidiLevels 一行文本每个字符的嵌入层级 rtl 为段落方向
+// 方向由双向文字算法的 Paragraph.Order 确定, 它只给出方向不给出层级:
+// 从右到左的为1级, 从右到左段落中从左到右的为2级, 从左到右段落中紧跟从右到左文字的数字为2级(规则 W7, I2)
+func bidiLevels(text []rune, rtl bool) []int {
+	base, shift := 0, 1
+	levels := make([]int, len(text))
+	var p bidi.Paragraph
+	if rtl {
+		base, shift = 1, 0
+		p.SetString(string(text), bidi.DefaultDirection(bidi.RightToLeft))
+	} else {
+		// 默认方向为从左到右时按第一个强方向字符确定方向, 开头加从左到右标记固定段落方向
+		p.SetString("\u200e"+string(text), bidi.DefaultDirection(bidi.LeftToRight))
+	}
+	o, err := p.Order()
+	if err != nil {
+		for i := range levels {
+			levels[i] = base
+		}
+		return levels
+	}
+	prevRTL := false
+	for i := 0; i < o.NumRuns(); i++ {
+		run := o.Run(i)
+		s, e := run.Pos()
+		s, e = maxInt(s-shift, 0), e-shift
+		rtlRun := run.Direction() == bidi.RightToLeft
+		level := base
+		if rtlRun != rtl {
+			level = base + 1
+		}
+		for j := s; j <= e; j++ {
+			levels[j] = level
+		}
+		if !rtl && !rtlRun && prevRTL {
+			// 第一个从左到右的字符之前的数字及其中间的分隔符, 之后的中性字符与从左到右的文字同级
+			last := s - 1
+			for j := s; j <= e; j++ {
+				prop, _ := bidi.LookupRune(text[j])
+				if prop.Class() == bidi.L {
+					break
+				}
+				switch prop.Class() {
+				case bidi.EN, bidi.AN, bidi.ET, bidi.NSM, bidi.BN:
+					last = j
+				}
+			}
+			for j := s; j <= last; j++ {
+				levels[j] = 2
+			}
+		}
+		prevRTL = rtlRun
+	}
+	return levels
+}
+
+// reorderRuns 按双向文字算法的 L2 规则把逻辑顺序的各段排列为视觉顺序
+func reorderRuns(runs []shapedRun) []shapedRun {
+	maxLevel := 0
+	for _, run := range runs {
+		maxLevel = maxInt(maxLevel, run.level)
+	}
+	for level := maxLevel; level >= 1; level-- {
+		for i := 0; i < len(runs); {
+			if runs[i].level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runs) && runs[j].level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				runs[a], runs[b] = runs[b], runs[a]
+			}
+			i = j
+		}
+	}
+	return runs
+}
+
+func lineKey(line textLine) string {
+	var b strings.Builder
+	for _, r := range line {
+		fmt.Fprintf(&b, "%v\x00%s\x00", r.Font, r.Text)
+	}
+	return b.String()
+}
+
+// drawGlyph 在 (x, y) 处绘制塑形后的字形 y 为基线, 彩色字体的字形按原有颜色绘制
+func (c *ICell) drawGlyph(dst draw.Image, fg color.Color, run *shapedRun, g shaping.Glyph, x, y fixed.Int26_6) {
+	if c.drawColorGlyph(dst, run.ft, run.out.Face, g.GlyphID, run.out.Size, fixed.Point26_6{X: x, Y: y}, fg) {
+		return
+	}
+	outline, ok := run.out.Face.GlyphData(g.GlyphID).(otfont.GlyphOutline)
+	if !ok {
+		return
+	}
+	scale := float32(run.out.Size) / 64 / float32(run.out.Face.Upem())
+	mask, at := rasterizeOutline(outline, scale, x, y, run.italic)
+	if mask == nil {
+		return
+	}
+	if run.bold > 0 {
+		mask = dilateMask(mask, run.bold)
+	}
+	draw.DrawMask(dst, mask.Bounds().Add(at), image.NewUniform(fg), image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// rasterizeOutline 把基线原点在 (x, y) 的字形轮廓光栅化为遮罩 at 为遮罩左上角的位置, 轮廓为空时返回nil
+// scale 为每个字体单位的像素
+func rasterizeOutline(outline otfont.GlyphOutline, scale float32, x, y fixed.Int26_6, italic bool) (mask *image.Alpha, at image.Point) {
+	if len(outline.Segments) == 0 {
+		return nil, at
+	}
+	ox, oy := float32(x)/64, float32(y)/64
+	point := func(p ot.SegmentPoint) (float32, float32) {
+		px, py := p.X*scale, p.Y*scale
+		if italic {
+			px += py * obliqueSlant
+		}
+		return ox + px, oy - py
+	}
+	minX, minY := float32(math.Inf(1)), float32(math.Inf(1))
+	maxX, maxY := float32(math.Inf(-1)), float32(math.Inf(-1))
+	for _, seg := range outline.Segments {
+		for _, p := range seg.ArgsSlice() {
+			px, py := point(p)
+			minX, minY = float32(math.Min(float64(minX), float64(px))), float32(math.Min(float64(minY), float64(py)))
+			maxX, maxY = float32(math.Max(float64(maxX), float64(px))), float32(math.Max(float64(maxY), float64(py)))
+		}
+	}
+	rect := image.Rect(int(math.Floor(float64(minX))), int(math.Floor(float64(minY))), int(math.Ceil(float64(maxX)))+1, int(math.Ceil(float64(maxY)))+1)
+	if rect.Empty() {
+		return nil, at
+	}
+	dx, dy := float32(rect.Min.X), float32(rect.Min.Y)
+	z := vector.NewRasterizer(rect.Dx(), rect.Dy())
+	for i, seg := range outline.Segments {
+		a := seg.ArgsSlice()
+		ax, ay := point(a[0])
+		switch seg.Op {
+		case ot.SegmentOpMoveTo:
+			if i > 0 {
+				z.ClosePath()
+			}
+			z.MoveTo(ax-dx, ay-dy)
+		case ot.SegmentOpLineTo:
+			z.LineTo(ax-dx, ay-dy)
+		case ot.SegmentOpQuadTo:
+			bx, by := point(a[1])
+			z.QuadTo(ax-dx, ay-dy, bx-dx, by-dy)
+		case ot.SegmentOpCubeTo:
+			bx, by := point(a[1])
+			cx, cy := point(a[2])
+			z.CubeTo(ax-dx, ay-dy, bx-dx, by-dy, cx-dx, cy-dy)
+		}
+	}
+	z.ClosePath()
+	mask = image.NewAlpha(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return mask, rect.Min
+}
+
+// dilateMask 向右加粗 n 像素 与 syntheticFace 模拟粗体的方式相同
+func dilateMask(mask *image.Alpha, n int) *image.Alpha {
+	b := mask.Bounds()
+	out := image.NewAlpha(image.Rect(0, 0, b.Dx()+n, b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			v := uint8(0)
+			for k := 0; k <= n; k++ {
+				if sx := x - k; sx >= 0 && sx < b.Dx() && mask.Pix[mask.PixOffset(sx, y)] > v {
+					v = mask.Pix[mask.PixOffset(sx, y)]
+				}
+			}
+			out.Pix[out.PixOffset(x, y)] = v
+		}
+	}
+	return out
+}
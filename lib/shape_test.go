@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+// visualText 塑形后从左到右的字符 字体中有的 ASCII 字符按字形还原, 可看出括号是否镜像
+func visualText(t *testing.T, value string, readingOrder uint64) string {
+	t.Helper()
+	font := Font{Name: "Go", Size: 11}
+	c := &ICell{Value: value, Style: &Style{Font: font, Alignment: Alignment{ReadingOrder: readingOrder}}, fonts: testFonts(t)}
+	text := []rune(value)
+	sl := c.layoutShaped(textLine{{Text: value, Font: font}}, text)
+	if sl == nil {
+		t.Fatal("not shaped")
+	}
+	var b strings.Builder
+	for _, run := range sl.runs {
+		for _, g := range run.out.Glyphs {
+			r := text[g.ClusterIndex]
+			if r < 0x80 {
+				for a := rune(0x20); a < 0x7f; a++ {
+					if gid, ok := run.out.Face.NominalGlyph(a); ok && gid == g.GlyphID {
+						r = a
+						break
+					}
+				}
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func TestLayoutShapedBidi(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        string
+		readingOrder uint64
+		want         string
+	}{
+		{"ltr paragraph", "abc אבג", 0, "abc גבא"},
+		{"rtl paragraph by content", "אבג abc", 0, "abc גבא"},
+		{"neutrals take the paragraph direction", "abc, אבג!", 0, "abc, גבא!"},
+		{"numbers between rtl text", "אבג 123 דה", 1, "הד 123 גבא"},
+		{"numbers after rtl text", "abc אבג 123 def", 0, "abc 123 גבא def"},
+		{"number with separators and percent", "אבג 1.5% abc", 1, "1.5% גבא abc"},
+		{"numbers after ltr text", "abc 123 אבג", 0, "abc 123 גבא"},
+		{"mirrored brackets", "אבג (דה) abc", 2, "abc (הד) גבא"},
+		{"brackets in ltr paragraph", "abc (אבג) def", 0, "abc (גבא) def"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visualText(t, tt.value, tt.readingOrder); got != tt.want {
+				t.Errorf("visual order %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
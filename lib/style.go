@@ -30,13 +30,16 @@ type Fill struct {
 }
 
 type Font struct {
-	Size      float64
-	Name      string
-	Color     string
-	Bold      bool
-	Italic    bool
-	Underline bool
+	Size   float64
+	Name   string
+	Color  string
+	Bold   bool
+	Italic bool
+	// Underline 下划线 single double singleAccounting doubleAccounting, 为空时没有下划线
+	Underline string
 	Strike    bool
+	// VertAlign 上标 superscript, 下标 subscript, 为空或 baseline 时不偏移
+	VertAlign string
 }
 
 type Alignment struct {
@@ -46,4 +49,6 @@ type Alignment struct {
 	TextRotation int
 	Vertical     string
 	WrapText     bool
+	// ReadingOrder 文字方向 0 根据内容, 1 从左到右, 2 从右到左
+	ReadingOrder uint64
 }
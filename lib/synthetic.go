@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"image"
+	"math"
+)
+
+// obliqueSlant 模拟斜体的倾斜比例 约12度
+const obliqueSlant = 0.21
+
+// syntheticFace 字体没有粗体或斜体时 通过加粗和倾斜常规字形模拟
+type syntheticFace struct {
+	font.Face
+	// bold 加粗的像素 为0时不加粗
+	bold   int
+	italic bool
+}
+
+// newSyntheticFace 模拟粗体和斜体 ppem 为字号的像素大小
+func newSyntheticFace(face font.Face, ppem float64, bold, italic bool) font.Face {
+	sf := &syntheticFace{Face: face, italic: italic}
+	if bold {
+		sf.bold = maxInt(1, int(math.Round(ppem/20)))
+	}
+	return sf
+}
+
+// slant 基线上方 y 像素处倾斜的偏移 y 向下为正
+func (f *syntheticFace) slant(y int) float64 {
+	if !f.italic {
+		return 0
+	}
+	return -float64(y) * obliqueSlant
+}
+
+func (f *syntheticFace) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	dr, mask, maskp, advance, ok = f.Face.Glyph(dot, r)
+	if !ok || dr.Empty() {
+		return dr, mask, maskp, advance + fixed.I(f.bold), ok
+	}
+	baseline := dot.Y.Round()
+	left := int(math.Floor(f.slant(dr.Max.Y - baseline)))
+	right := int(math.Ceil(f.slant(dr.Min.Y-baseline))) + f.bold
+	out := image.NewAlpha(image.Rect(dr.Min.X+left, dr.Min.Y, dr.Max.X+right, dr.Max.Y))
+	src := func(x, y int) float64 {
+		if x < dr.Min.X || x >= dr.Max.X {
+			return 0
+		}
+		_, _, _, a := mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+		return float64(a)
+	}
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		// 按行水平平移实现倾斜 小数部分在相邻像素间插值
+		shift := f.slant(y - baseline)
+		whole := math.Floor(shift)
+		frac := shift - whole
+		for x := out.Rect.Min.X; x < out.Rect.Max.X; x++ {
+			v := 0.0
+			for k := 0; k <= f.bold; k++ {
+				sx := x - int(whole) - k
+				v = math.Max(v, src(sx, y)*(1-frac)+src(sx-1, y)*frac)
+			}
+			out.Pix[out.PixOffset(x, y)] = uint8(v / 0xffff * 0xff)
+		}
+	}
+	return out.Rect, out, out.Rect.Min, advance + fixed.I(f.bold), true
+}
+
+func (f *syntheticFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	bounds, advance, ok = f.Face.GlyphBounds(r)
+	if f.italic {
+		bounds.Min.X += fixed.Int26_6(-float64(bounds.Max.Y) * obliqueSlant)
+		bounds.Max.X += fixed.Int26_6(-float64(bounds.Min.Y) * obliqueSlant)
+	}
+	bounds.Max.X += fixed.I(f.bold)
+	return bounds, advance + fixed.I(f.bold), ok
+}
+
+func (f *syntheticFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	advance, ok = f.Face.GlyphAdvance(r)
+	return advance + fixed.I(f.bold), ok
+}
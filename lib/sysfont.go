@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// substituteGroups 名称相同的字体族和度量兼容或风格相近的替代字体族
+// names 中的名称互为别名, 任一名称未安装时依次尝试其他名称和 subs
+var substituteGroups = []struct {
+	names []string
+	subs  []string
+}{
+	{[]string{"Calibri"}, []string{"Carlito"}},
+	{[]string{"Calibri Light"}, []string{"Carlito"}},
+	{[]string{"Cambria"}, []string{"Caladea"}},
+	{[]string{"Arial", "Helvetica"}, []string{"Liberation Sans", "Arimo", "DejaVu Sans"}},
+	{[]string{"Arial Narrow"}, []string{"Liberation Sans Narrow"}},
+	{[]string{"Times New Roman", "Times"}, []string{"Liberation Serif", "Tinos", "DejaVu Serif"}},
+	{[]string{"Courier New", "Courier"}, []string{"Liberation Mono", "Cousine", "DejaVu Sans Mono"}},
+	{[]string{"Georgia"}, []string{"Gelasio", "DejaVu Serif"}},
+	{[]string{"Verdana", "Tahoma", "Segoe UI"}, []string{"DejaVu Sans", "Liberation Sans"}},
+	{[]string{"Consolas"}, []string{"DejaVu Sans Mono", "Liberation Mono"}},
+	{[]string{"等线", "DengXian"}, []string{"Noto Sans CJK SC", "Noto Sans SC", "Source Han Sans SC", "Source Han Sans CN", "WenQuanYi Micro Hei", "Droid Sans Fallback"}},
+	{[]string{"微软雅黑", "Microsoft YaHei"}, []string{"Noto Sans CJK SC", "Noto Sans SC", "Source Han Sans SC", "Source Han Sans CN", "WenQuanYi Micro Hei", "Droid Sans Fallback"}},
+	{[]string{"黑体", "SimHei"}, []string{"Noto Sans CJK SC", "Source Han Sans SC", "WenQuanYi Zen Hei", "WenQuanYi Micro Hei"}},
+	{[]string{"宋体", "SimSun", "新宋体", "NSimSun"}, []string{"Noto Serif CJK SC", "Noto Serif SC", "Source Han Serif SC", "AR PL UMing CN", "AR PL SungtiL GB"}},
+	{[]string{"仿宋", "FangSong", "仿宋_GB2312", "FangSong_GB2312"}, []string{"Noto Serif CJK SC", "Source Han Serif SC", "AR PL UMing CN"}},
+	{[]string{"楷体", "KaiTi", "楷体_GB2312", "KaiTi_GB2312"}, []string{"AR PL UKai CN", "AR PL KaitiM GB", "Noto Serif CJK SC"}},
+	{[]string{"sans-serif"}, []string{"Liberation Sans", "DejaVu Sans", "Noto Sans"}},
+	{[]string{"serif"}, []string{"Liberation Serif", "DejaVu Serif", "Noto Serif"}},
+	{[]string{"monospace"}, []string{"Liberation Mono", "DejaVu Sans Mono", "Noto Sans Mono"}},
+}
+
+// ExcelFonts Excel 中常用的字体 fonts list 命令列出它们匹配到的字体
+var ExcelFonts = []string{
+	"Calibri", "Calibri Light", "Cambria", "Arial", "Times New Roman", "Courier New", "Verdana", "Tahoma",
+	"等线", "宋体", "黑体", "微软雅黑", "仿宋", "楷体",
+}
+
+func defaultSubstitutes() map[string][]string {
+	m := map[string][]string{}
+	for _, g := range substituteGroups {
+		for _, name := range g.names {
+			key := familyKey(name)
+			for _, alias := range g.names {
+				if alias != name {
+					m[key] = append(m[key], alias)
+				}
+			}
+			m[key] = append(m[key], g.subs...)
+		}
+	}
+	return m
+}
+
+// SetSubstitutes 设置字体族 family 未安装时依次尝试的替代字体族 覆盖默认的替代字体
+func (r *FontRegistry) SetSubstitutes(family string, subs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetGlyphs()
+	r.substitutes[familyKey(family)] = subs
+}
+
+// FontMatch 字体族名称匹配到的字体
+type FontMatch struct {
+	// Family 实际使用的字体族 没有任何字体时为空
+	Family string
+	// Substitute 使用的是替代字体
+	Substitute bool
+	// Fallback 没有该字体和替代字体 使用的是备用字体
+	Fallback bool
+}
+
+// Match 查找字体族名称实际使用的字体族 与 Lookup 的规则相同
+func (r *FontRegistry) Match(family string) FontMatch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fam, substitute := r.findFamily(family)
+	if fam != nil {
+		return FontMatch{Family: fam.name, Substitute: substitute}
+	}
+	if fam = r.fallbackFamily(); fam != nil {
+		return FontMatch{Family: fam.name, Fallback: true}
+	}
+	return FontMatch{}
+}
+
+// Styles 字体族已注册的样式 regular bold italic bold-italic
+func (r *FontRegistry) Styles(family string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	styles := make([]string, 0)
+	fam, ok := r.families[familyKey(family)]
+	if !ok {
+		return styles
+	}
+	for i, name := range []string{"regular", "bold", "italic", "bold-italic"} {
+		if fam.faces[i] != nil {
+			styles = append(styles, name)
+		}
+	}
+	return styles
+}
+
+// SystemFontDirs 当前系统的标准字体目录 只返回存在的目录
+func SystemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	dirs := make([]string, 0)
+	switch runtime.GOOS {
+	case "windows":
+		dirs = append(dirs, filepath.Join(os.Getenv("WINDIR"), "Fonts"))
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			dirs = append(dirs, filepath.Join(local, "Microsoft", "Windows", "Fonts"))
+		}
+	case "darwin":
+		dirs = append(dirs, "/System/Library/Fonts", "/Library/Fonts")
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, "Library", "Fonts"))
+		}
+	default:
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" && home != "" {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		dataDirs := os.Getenv("XDG_DATA_DIRS")
+		if dataDirs == "" {
+			dataDirs = "/usr/local/share:/usr/share"
+		}
+		if dataHome != "" {
+			dirs = append(dirs, filepath.Join(dataHome, "fonts"))
+		}
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, ".fonts"))
+		}
+		for _, d := range strings.Split(dataDirs, ":") {
+			if d != "" {
+				dirs = append(dirs, filepath.Join(d, "fonts"))
+			}
+		}
+	}
+	exists := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if fi, err := os.Stat(d); err == nil && fi.IsDir() && !containsString(exists, d) {
+			exists = append(exists, d)
+		}
+	}
+	return exists
+}
+
+// LoadSystem 加载 SystemFontDirs 中全部的字体
+// CFF 轮廓的 OTF 直接跳过, 其他无法解析的字体会被跳过 并在返回的错误中列出
+func (r *FontRegistry) LoadSystem() error {
+	failed := make([]string, 0)
+	for _, dir := range SystemFontDirs() {
+		if err := r.LoadDir(dir); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", dir, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to load system fonts: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
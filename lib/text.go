@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"golang.org/x/image/font"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IRun 富文本中格式相同的一段文本
+type IRun struct {
+	Text string
+	Font Font
+}
+
+// textLine 一行文本 由一段或多段格式不同的文本组成
+type textLine []*IRun
+
+func (l textLine) String() string {
+	var b strings.Builder
+	for _, r := range l {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+// splitRuns 按换行符拆分为段落 (Alt+Enter 输入的换行为 \n)
+func splitRuns(runs []*IRun) []textLine {
+	paras := []textLine{{}}
+	for _, r := range runs {
+		for i, text := range strings.Split(strings.ReplaceAll(r.Text, "\r\n", "\n"), "\n") {
+			if i > 0 {
+				paras = append(paras, textLine{})
+			}
+			if text != "" {
+				paras[len(paras)-1] = append(paras[len(paras)-1], &IRun{Text: text, Font: r.Font})
+			}
+		}
+	}
+	return paras
+}
+
+// sliceRuns 截取一行文本中 [start, end) 字节范围的部分
+func sliceRuns(line textLine, start, end int) textLine {
+	sliced := make(textLine, 0, len(line))
+	offset := 0
+	for _, r := range line {
+		s, e := maxInt(start-offset, 0), minInt(end-offset, len(r.Text))
+		if s < e {
+			sliced = append(sliced, &IRun{Text: r.Text[s:e], Font: r.Font})
+		}
+		offset += len(r.Text)
+	}
+	return sliced
+}
+
+// wrapText 将一行文本按宽度 maxWidth 折行 返回每一行的字节范围, measure 为 s[start:end] 的宽度
+// 拉丁文在单词之间折行, 中日韩文字可在任意两个字之间折行, 单个单词超出宽度时按字符折行
+func wrapText(s string, maxWidth int, measure func(start, end int) int) [][2]int {
+	lines := make([][2]int, 0, 1)
+	trimEnd := func(start, end int) int {
+		return start + len(strings.TrimRight(s[start:end], " "))
+	}
+	cur := 0
+	for _, tok := range breakTokens(s) {
+		if tok[0] > cur && measure(cur, trimEnd(cur, tok[1])) > maxWidth {
+			lines = append(lines, [2]int{cur, trimEnd(cur, tok[0])})
+			cur = tok[0]
+		}
+		for cur == tok[0] && measure(cur, trimEnd(cur, tok[1])) > maxWidth && utf8.RuneCountInString(s[cur:tok[1]]) > 1 {
+			end := fitRunes(s, cur, tok[1], maxWidth, measure)
+			lines = append(lines, [2]int{cur, end})
+			cur, tok[0] = end, end
+		}
+	}
+	return append(lines, [2]int{cur, trimEnd(cur, len(s))})
+}
+
+// breakTokens 按可折行的位置拆分文本 返回每部分的字节范围, 单词后的空格归属于该单词
+func breakTokens(line string) [][2]int {
+	tokens := make([][2]int, 0)
+	start, space := 0, false
+	for i, r := range line {
+		switch {
+		case isCJK(r):
+			if i > start {
+				tokens = append(tokens, [2]int{start, i})
+			}
+			tokens = append(tokens, [2]int{i, i + utf8.RuneLen(r)})
+			start, space = i+utf8.RuneLen(r), false
+		case r == ' ':
+			space = true
+		case space:
+			tokens = append(tokens, [2]int{start, i})
+			start, space = i, false
+		}
+	}
+	if start < len(line) {
+		tokens = append(tokens, [2]int{start, len(line)})
+	}
+	return tokens
+}
+
+// fitRunes s[start:end] 中从 start 开始宽度 maxWidth 内能放下的结束位置 至少包含一个字符
+func fitRunes(s string, start, end, maxWidth int, measure func(start, end int) int) int {
+	fit := start
+	for i, r := range s[start:end] {
+		e := start + i + utf8.RuneLen(r)
+		if fit > start && measure(start, e) > maxWidth {
+			break
+		}
+		fit = e
+	}
+	return fit
+}
+
+func measureText(face font.Face, s string) int {
+	return font.MeasureString(face, s).Ceil()
+}
+
+// isCJK 中日韩文字及全角标点
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+// spacedPieces 两端对齐和分散对齐时拆分文本 在拆分的各部分之间增加间距, 返回每部分的字节范围
+// 按单词拆分(单词后的空格归属于该单词), 中日韩文字每个字单独拆分
+// byChar 为true时没有多个单词的文本按字符拆分
+func spacedPieces(line string, byChar bool) [][2]int {
+	tokens := breakTokens(line)
+	if len(tokens) > 1 || !byChar {
+		return tokens
+	}
+	pieces := make([][2]int, 0, len(line))
+	for i, r := range line {
+		pieces = append(pieces, [2]int{i, i + utf8.RuneLen(r)})
+	}
+	return pieces
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/xuri/excelize/v2"
+	"strconv"
+	"strings"
+)
+
+// excelize 解析样式表时丢弃了字体的 vertAlign(上标, 下标), 字体的上下标从工作簿关系中的样式表 XML 读取
+// excelize 新建样式时只在末尾添加字体, 已有字体的序号不变, 新添加的字体没有上下标
+// 富文本每一段的上下标从 excelize 解析的共享字符串读取, 按单元格中共享字符串的序号对应
+
+// vertAligns 工作簿中字体的上下标
+type vertAligns struct {
+	file *excelize.File
+	// fonts 按样式表中字体的序号
+	fonts []string
+	// sst 按工作表和单元格名称 共享字符串单元格中共享字符串的序号, 用到时读取
+	sst map[string]map[string]int
+}
+
+type xlsxStyleFonts struct {
+	Font []struct {
+		VertAlign *struct {
+			Val string `xml:"val,attr"`
+		} `xml:"vertAlign"`
+	} `xml:"fonts>font"`
+}
+
+// xlsxSheetCells 工作表中单元格的类型和值
+type xlsxSheetCells struct {
+	Row []struct {
+		C []struct {
+			R string `xml:"r,attr"`
+			T string `xml:"t,attr"`
+			V string `xml:"v"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// getVertAligns 当前工作簿的上下标 换工作簿时重新读取
+func (d *Ex2Img) getVertAligns(file *excelize.File) *vertAligns {
+	if d.vertAligns == nil || d.vertAligns.file != file {
+		d.vertAligns = &vertAligns{file: file, fonts: styleFontVertAligns(file), sst: map[string]map[string]int{}}
+	}
+	return d.vertAligns
+}
+
+// fontVertAlign 样式表中第 fontID 个字体的上下标
+func (d *Ex2Img) fontVertAlign(file *excelize.File, fontID int) string {
+	fonts := d.getVertAligns(file).fonts
+	if fontID < 0 || fontID >= len(fonts) {
+		return ""
+	}
+	return fonts[fontID]
+}
+
+// runVertAligns 单元格富文本每一段的上下标 没有上下标时为nil
+func (d *Ex2Img) runVertAligns(file *excelize.File, sheet, axis string) []string {
+	va := d.getVertAligns(file)
+	cells, ok := va.sst[sheet]
+	if !ok {
+		cells = sharedStringCells(file, sheet)
+		va.sst[sheet] = cells
+	}
+	idx, ok := cells[axis]
+	sst := file.SharedStrings
+	if !ok || sst == nil || idx < 0 || idx >= len(sst.SI) {
+		return nil
+	}
+	runs := sst.SI[idx].R
+	aligns, found := make([]string, len(runs)), false
+	for i, r := range runs {
+		if r.RPr != nil && r.RPr.VertAlign != nil && r.RPr.VertAlign.Val != nil {
+			aligns[i], found = *r.RPr.VertAlign.Val, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return aligns
+}
+
+// sharedStringCells 工作表中共享字符串单元格的名称到共享字符串的序号
+func sharedStringCells(file *excelize.File, sheet string) map[string]int {
+	cells := map[string]int{}
+	var ws xlsxSheetCells
+	if err := decodeWorksheet(file, sheet, &ws); err != nil {
+		return cells
+	}
+	for _, row := range ws.Row {
+		for _, c := range row.C {
+			if c.T != "s" || c.R == "" {
+				continue
+			}
+			if idx, err := strconv.Atoi(strings.TrimSpace(c.V)); err == nil {
+				cells[c.R] = idx
+			}
+		}
+	}
+	return cells
+}
+
+// styleFontVertAligns 读取样式表中每个字体的上下标
+func styleFontVertAligns(file *excelize.File) []string {
+	stylesPath := workbookPart(file, func(_, relType string) bool {
+		return strings.HasSuffix(relType, "/styles")
+	})
+	buf, ok := file.Pkg.Load(stylesPath)
+	if !ok {
+		return nil
+	}
+	var fonts xlsxStyleFonts
+	if err := xml.NewDecoder(bytes.NewReader(buf.([]byte))).Decode(&fonts); err != nil {
+		return nil
+	}
+	aligns := make([]string, len(fonts.Font))
+	for i, f := range fonts.Font {
+		if f.VertAlign != nil {
+			aligns[i] = f.VertAlign.Val
+		}
+	}
+	return aligns
+}
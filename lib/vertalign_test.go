@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+const vertAlignStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Go"/></font><font><vertAlign val="superscript"/><sz val="11"/><name val="Go"/></font></fonts>` +
+	`<fills count="1"><fill><patternFill patternType="none"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// 文本相同的富文本 按共享字符串的序号取各自的上下标
+const vertAlignStrings = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="3" uniqueCount="3">` +
+	`<si><r><t>x</t></r><r><rPr><vertAlign val="superscript"/></rPr><t>2</t></r></si>` +
+	`<si><r><t>x</t></r><r><rPr><vertAlign val="subscript"/></rPr><t>2</t></r></si>` +
+	`<si><r><rPr><b/></rPr><t>x</t></r><r><t>2</t></r></si>` +
+	`</sst>`
+
+func TestVertAligns(t *testing.T) {
+	f := openWorkbookParts(t, map[string]string{
+		"xl/styles.xml":        vertAlignStyles,
+		"xl/sharedStrings.xml": vertAlignStrings,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" s="1" t="s"><v>1</v></c></row>` +
+			`</sheetData></worksheet>`,
+	})
+	d := &Ex2Img{}
+	tests := []struct {
+		axis string
+		want []string
+	}{
+		{"A1", []string{"", "superscript"}},
+		{"B1", []string{"", "subscript"}},
+		{"C1", nil},
+		{"D1", []string{"", "subscript"}},
+		{"E1", nil},
+	}
+	// readRuns 先读取富文本 excelize 此时解析共享字符串
+	if _, err := f.GetCellRichText("Sheet1", "A1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := d.runVertAligns(f, "Sheet1", tt.axis); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.axis, got, tt.want)
+		}
+	}
+	if got := d.GetStyle(f, 0).Font.VertAlign; got != "" {
+		t.Errorf("style 0 vertAlign %q, want none", got)
+	}
+	if got := d.GetStyle(f, 1).Font.VertAlign; got != "superscript" {
+		t.Errorf("style 1 vertAlign %q, want superscript", got)
+	}
+
+	// 在内存中写入的单元格 按新的共享字符串序号对应
+	if err := f.SetCellStr("Sheet1", "E1", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellValue("Sheet1", "A1", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	d.vertAligns = nil
+	if got := d.runVertAligns(f, "Sheet1", "A1"); got != nil {
+		t.Errorf("A1 after edit: got %q, want nil", got)
+	}
+	if got := d.runVertAligns(f, "Sheet1", "B1"); !reflect.DeepEqual(got, []string{"", "subscript"}) {
+		t.Errorf("B1 after edit: got %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"path"
+	"strings"
+	"sync"
+)
+
+// excelize 没有开放分页符, 页面设置, 行列的折叠等属性的读取接口
+// 这里把 excelize 解析后的工作表重新编码为 XML 再解码到本地结构, 其余属性使用 excelize 的接口读取
+
+// xlsxWorksheet 工作表中需要直接解码的节点
+type xlsxWorksheet struct {
+	SheetPr   xlsxSheetPr   `xml:"sheetPr"`
+	Cols      xlsxCols      `xml:"cols"`
+	SheetData xlsxSheetData `xml:"sheetData"`
+	RowBreaks xlsxBreaks    `xml:"rowBreaks"`
+	ColBreaks xlsxBreaks    `xml:"colBreaks"`
+	PageSetUp xlsxPageSetUp `xml:"pageSetup"`
+}
+
+// xlsxSheetPr excelize 只开放了分级显示的 summaryBelow
+type xlsxSheetPr struct {
+	OutlinePr struct {
+		SummaryRight *bool `xml:"summaryRight,attr"`
+	} `xml:"outlinePr"`
+}
+
+type xlsxBreaks struct {
+	Brk []struct {
+		ID int `xml:"id,attr"`
+	} `xml:"brk"`
+}
+
+type xlsxPageSetUp struct {
+	PageOrder string `xml:"pageOrder,attr"`
+}
+
+type xlsxCols struct {
+	Col []xlsxCol `xml:"col"`
+}
+
+// xlsxCol 列属性 宽度, 隐藏和层级在 readCols 中由 excelize 的接口读取
+// excelize 把宽度0当作未设置, 这里保留原始宽度判断宽度为0的隐藏列
+type xlsxCol struct {
+	Min          int     `xml:"min,attr"`
+	Max          int     `xml:"max,attr"`
+	Width        float64 `xml:"width,attr"`
+	CustomWidth  bool    `xml:"customWidth,attr"`
+	Collapsed    bool    `xml:"collapsed,attr"`
+	Hidden       bool    `xml:"-"`
+	OutlineLevel uint8   `xml:"-"`
+}
+
+type xlsxSheetData struct {
+	Row []xlsxRowAttr `xml:"row"`
+}
+
+// xlsxRowAttr 行属性 不含单元格, 隐藏和层级在 readRows 中, 行高在 rowPoints 中由 excelize 的接口读取
+// 原始行高只用于判断行高为0的隐藏行和是否设置了行高
+type xlsxRowAttr struct {
+	R            int     `xml:"r,attr"`
+	Ht           float64 `xml:"ht,attr"`
+	CustomHeight bool    `xml:"customHeight,attr"`
+	Collapsed    bool    `xml:"collapsed,attr"`
+	Hidden       bool    `xml:"-"`
+	OutlineLevel uint8   `xml:"-"`
+}
+
+// readWorksheet 解码工作表当前的内容
+func readWorksheet(file *excelize.File, sheet string) (*xlsxWorksheet, error) {
+	ws := &xlsxWorksheet{}
+	if err := decodeWorksheet(file, sheet, ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// decodeWorksheet 把工作表当前的内容解码到 v
+// excelize 在内存中修改的工作表只在保存或调用 Rows 时写回包内, 包内的原始 XML 可能是旧的
+func decodeWorksheet(file *excelize.File, sheet string, v interface{}) error {
+	// 确保工作表已由 excelize 读取 大的工作表初始时保存在临时文件中
+	if _, err := file.GetMergeCells(sheet); err != nil {
+		return err
+	}
+	sheetPath, err := worksheetPath(file, sheet)
+	if err != nil {
+		return err
+	}
+	content, ok := partXML(file, &file.Sheet, sheetPath)
+	if !ok {
+		return fmt.Errorf("sheet %s is not loaded", sheet)
+	}
+	if err = xml.NewDecoder(bytes.NewReader(content)).Decode(v); err != nil {
+		return fmt.Errorf("sheet %s: %v", sheet, err)
+	}
+	return nil
+}
+
+// partXML 包内部件当前的 XML excelize 已解析的部件在 parsed 中, 从解析后的结构重新编码
+func partXML(file *excelize.File, parsed *sync.Map, name string) ([]byte, bool) {
+	if v, ok := parsed.Load(name); ok && v != nil {
+		if l, ok := v.(sync.Locker); ok {
+			l.Lock()
+			defer l.Unlock()
+		}
+		if content, err := xml.Marshal(v); err == nil && len(content) > 0 {
+			return content, true
+		}
+	}
+	content, ok := file.Pkg.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return content.([]byte), true
+}
+
+type xlsxRelationships struct {
+	Relationship []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// worksheetPath 工作表在包内的路径 如 xl/worksheets/sheet1.xml
+func worksheetPath(file *excelize.File, sheet string) (string, error) {
+	rID := ""
+	for _, s := range file.WorkBook.Sheets.Sheet {
+		if s.Name == sheet {
+			rID = s.ID
+		}
+	}
+	sheetPath := workbookPart(file, func(id, _ string) bool {
+		return id == rID
+	})
+	if sheetPath == "" {
+		return "", fmt.Errorf("sheet %s does not exist", sheet)
+	}
+	return sheetPath, nil
+}
+
+// workbookPart 工作簿的关系中第一个满足 match 的部件在包内的路径 没有时为空字符串
+func workbookPart(file *excelize.File, match func(id, relType string) bool) string {
+	var partPath string
+	file.Pkg.Range(func(key, _ interface{}) bool {
+		relsPath := key.(string)
+		if !strings.HasSuffix(relsPath, "workbook.xml.rels") {
+			return true
+		}
+		// 新建的工作表只在 excelize 解析的关系中
+		content, _ := partXML(file, &file.Relationships, relsPath)
+		var rels xlsxRelationships
+		if err := xml.Unmarshal(content, &rels); err != nil {
+			return true
+		}
+		for _, rel := range rels.Relationship {
+			if !match(rel.ID, rel.Type) {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				partPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				partPath = path.Join(path.Dir(path.Dir(relsPath)), rel.Target)
+			}
+			return false
+		}
+		return true
+	})
+	return partPath
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/xuri/excelize/v2"
 	"log"
+	"os"
 	"strings"
+	"text/tabwriter"
 )
 
 var rootCmd = &cobra.Command{
@@ -15,12 +17,55 @@ var rootCmd = &cobra.Command{
 	Short:   "excel2img:  {excelPath} {output}",
 	Long:    "excel2img:  {excelPath} {output}",
 	Version: "0.0.1",
+	Args:    cobra.ArbitraryArgs,
 	Run:     drawExcelToPng,
 }
 
+var fontsCmd = &cobra.Command{
+	Use:   "fonts",
+	Short: "font tools",
+}
+
+var fontsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the installed font families and the fonts matched for common Excel fonts",
+	Args:  cobra.NoArgs,
+	Run:   listFonts,
+}
+
 //go:embed fonts
 var fonts embed.FS
 
+var (
+	sheet         string
+	cellRange     string
+	allSheets     bool
+	pages         bool
+	autoFit       bool
+	showHidden    bool
+	includeHidden bool
+	nameTpl       string
+	fontDirs      []string
+	systemFonts   bool
+	locale        string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&sheet, "sheet", "", "sheet name, index (from 0) or @active, default the first sheet")
+	rootCmd.Flags().StringVar(&cellRange, "range", "", "cell range to render, e.g. B3:H40, Sheet1!B3:H40 or a defined name")
+	rootCmd.Flags().BoolVar(&allSheets, "all", false, "render every sheet to its own image, {output} is used as {base}")
+	rootCmd.Flags().BoolVar(&pages, "pages", false, "split by print area and page breaks, {output}.pdf writes one PDF, otherwise one image per page")
+	rootCmd.Flags().BoolVar(&autoFit, "autofit", false, "size columns and rows by content instead of the workbook's widths and heights")
+	rootCmd.Flags().BoolVar(&showHidden, "show-hidden", false, "show hidden rows and columns, including collapsed outline groups")
+	rootCmd.Flags().BoolVar(&includeHidden, "hidden", false, "include hidden sheets when rendering all sheets")
+	rootCmd.Flags().StringVar(&locale, "locale", lib.DefaultLocale, "locale of the built-in number formats, e.g. zh-CN, zh-TW, ja-JP, ko-KR, en-US")
+	rootCmd.Flags().StringVar(&nameTpl, "name", lib.DefaultSheetFileName, "file name template when rendering all sheets")
+	rootCmd.PersistentFlags().StringSliceVar(&fontDirs, "font-dir", nil, "additional directory of .ttf/.otf/.ttc fonts, can be repeated")
+	rootCmd.PersistentFlags().BoolVar(&systemFonts, "system-fonts", false, "also load the fonts in the system font directories")
+	fontsCmd.AddCommand(fontsListCmd)
+	rootCmd.AddCommand(fontsCmd)
+}
+
 func main() {
 	err := lib.Init(fonts)
 	if err != nil {
@@ -35,7 +80,15 @@ func drawExcelToPng(cmd *cobra.Command, args []string) {
 	if len(args) != 2 {
 		log.Fatal("please input {excelPath} {output}")
 	}
-	e2i := lib.Ex2Img{}
+	e2i := lib.Ex2Img{
+		Sheet:         sheet,
+		Range:         cellRange,
+		AutoFit:       autoFit,
+		ShowHidden:    showHidden,
+		IncludeHidden: includeHidden,
+		Locale:        locale,
+	}
+	loadFonts()
 	excelFile := args[0]
 	output := args[1]
 	file, err := excelize.OpenFile(excelFile)
@@ -43,8 +96,90 @@ func drawExcelToPng(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 		return
 	}
+	if allSheets {
+		drawAllSheets(&e2i, file, output)
+		return
+	}
+	if pages {
+		drawPages(&e2i, file, output)
+		return
+	}
 	if !strings.HasSuffix(output, ".png") && !strings.HasSuffix(output, ".PNG") {
 		output = fmt.Sprintf("%s.png", output)
 	}
-	e2i.DrawExcelToPngFile(file, output)
+	if err := e2i.DrawExcelToPngFile(file, output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadFonts 加载系统字体和 --font-dir 的字体 无法解析的字体只提示 不影响其他字体
+func loadFonts() {
+	if systemFonts {
+		if err := lib.DefaultFonts.LoadSystem(); err != nil {
+			log.Printf("system fonts: %v", err)
+		}
+	}
+	for _, dir := range fontDirs {
+		if err := lib.DefaultFonts.LoadDir(dir); err != nil {
+			log.Printf("font dir %s: %v", dir, err)
+		}
+	}
+}
+
+func listFonts(cmd *cobra.Command, args []string) {
+	systemFonts = true
+	loadFonts()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FAMILY\tSTYLES")
+	for _, family := range lib.DefaultFonts.Families() {
+		fmt.Fprintf(w, "%s\t%s\n", family, strings.Join(lib.DefaultFonts.Styles(family), " "))
+	}
+	fmt.Fprintln(w, "\nEXCEL FONT\tMATCH")
+	for _, family := range lib.ExcelFonts {
+		m := lib.DefaultFonts.Match(family)
+		switch {
+		case m.Family == "":
+			fmt.Fprintf(w, "%s\t-\n", family)
+		case m.Substitute:
+			fmt.Fprintf(w, "%s\t%s (substitute)\n", family, m.Family)
+		case m.Fallback:
+			fmt.Fprintf(w, "%s\t%s (fallback)\n", family, m.Family)
+		default:
+			fmt.Fprintf(w, "%s\t%s\n", family, m.Family)
+		}
+	}
+	w.Flush()
+}
+
+func drawAllSheets(e2i *lib.Ex2Img, file *excelize.File, output string) {
+	base := strings.TrimSuffix(strings.TrimSuffix(output, ".png"), ".PNG")
+	failed := 0
+	for _, result := range e2i.DrawAllSheetsToPngFile(file, base, nameTpl) {
+		if result.Err != nil {
+			failed++
+			log.Printf("sheet %d %s: %v", result.Index, result.Sheet, result.Err)
+			continue
+		}
+		log.Printf("sheet %d %s: %s", result.Index, result.Sheet, result.Output)
+	}
+	if failed > 0 {
+		log.Fatalf("%d sheet(s) failed", failed)
+	}
+}
+
+func drawPages(e2i *lib.Ex2Img, file *excelize.File, output string) {
+	if strings.HasSuffix(output, ".pdf") || strings.HasSuffix(output, ".PDF") {
+		if err := e2i.DrawPagesToPdfFile(file, output); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	base := strings.TrimSuffix(strings.TrimSuffix(output, ".png"), ".PNG")
+	outputs, err := e2i.DrawPagesToPngFile(file, base)
+	for _, o := range outputs {
+		log.Printf("page: %s", o)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }